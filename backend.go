@@ -2,21 +2,30 @@ package os2
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
 	"sync"
+	"time"
 )
 
 var blog hclog.Logger
 
 type backend struct {
 	*framework.Backend
-	lock   sync.RWMutex
-	client *ecsClient
+	lock sync.RWMutex
+	// clients caches one object store client per connection name
+	clients map[string]ObjectStoreProvider
+	// roleLock serializes changes to the access keys stored on roles
+	roleLock sync.Mutex
+	// configLock serializes management password rotations
+	configLock sync.Mutex
+	// rootRotationFailures and rootRotationRetryAt back off failed scheduled password rotations per connection,
+	// they are only touched by the periodic func
+	rootRotationFailures map[string]int
+	rootRotationRetryAt  map[string]time.Time
 }
 
 var _ logical.Factory = Factory
@@ -37,7 +46,11 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 }
 
 func newBackend() *backend {
-	b := &backend{}
+	b := &backend{
+		clients:              map[string]ObjectStoreProvider{},
+		rootRotationFailures: map[string]int{},
+		rootRotationRetryAt:  map[string]time.Time{},
+	}
 	b.Backend = &framework.Backend{
 		BackendType: logical.TypeLogical,
 		Paths: framework.PathAppend(
@@ -45,63 +58,95 @@ func newBackend() *backend {
 			pathConfig(b),
 			[]*framework.Path{pathCreds(b)},
 			[]*framework.Path{pathRotateRole(b)},
+			[]*framework.Path{pathRoleImport(b)},
+			pathBucket(b),
+			pathNamespace(b),
+			pathSafe(b),
 		),
-		Invalidate: b.invalidate,
+		InitializeFunc:    b.initialize,
+		Invalidate:        b.invalidate,
+		PeriodicFunc:      b.periodicFunc,
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: walRollbackMinAge,
 
 		PathsSpecial: &logical.Paths{
-			LocalStorage: []string{},
+			LocalStorage: []string{
+				framework.WALPrefix,
+			},
 			SealWrapStorage: []string{
 				"config",
+				"config/*",
 				"role/*",
 			},
 		},
 		Secrets: []*framework.Secret{
 			b.secretAccessKey(),
+			b.secretAssumedRole(),
 		},
 	}
 	return b
 }
 
-func (b *backend) reset() {
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if !b.canWrite() {
+		return nil
+	}
+	connections, err := listConnections(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	for _, connection := range connections {
+		if err := b.recoverPendingPassword(ctx, req.Storage, connection); err != nil {
+			// don't fail the mount, the operator can still fix the config
+			b.Logger().Error("recovering pending password", "connection", connection, "error", err)
+		}
+	}
+	return nil
+}
+
+// reset drops the cached client of the connection so the next invocation picks up config changes
+func (b *backend) reset(connection string) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
-	b.client = nil
+	delete(b.clients, connection)
 }
 
 func (b *backend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
-		b.reset()
+	if key == configStoragePath {
+		b.reset(defaultConnection)
+	} else if connection, ok := strings.CutPrefix(key, configStoragePath+"/"); ok {
+		b.reset(connection)
 	}
 }
 
-func (b *backend) getClient(ctx context.Context, storage logical.Storage) (*ecsClient, error) {
-	b.lock.RLock()
-	unlockFunc := b.lock.RUnlock
-	defer func() { unlockFunc() }()
-
-	if b.client != nil {
-		return b.client, nil
+// getClient returns the object store client of the connection, the default connection when empty
+func (b *backend) getClient(ctx context.Context, storage logical.Storage, connection string) (ObjectStoreProvider, error) {
+	if connection == "" {
+		connection = defaultConnection
 	}
+	b.lock.RLock()
+	client, ok := b.clients[connection]
 	b.lock.RUnlock()
-	config, err := GetConfig(ctx, storage)
+	if ok {
+		return client, nil
+	}
+
+	config, err := GetConfig(ctx, storage, connection)
 	if err != nil {
 		return nil, err
 	}
 	if config == nil {
-		return nil, errors.New("missing plugin config")
+		return nil, fmt.Errorf("missing plugin config for connection %s", connection)
 	}
 	b.lock.Lock()
-	unlockFunc = b.lock.Unlock
-	b.client, err = newClient(config)
+	defer b.lock.Unlock()
+	if client, ok := b.clients[connection]; ok {
+		return client, nil
+	}
+	client, err = newProvider(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-
-	return b.client, nil
-
-}
-
-func debug(obj any) {
-	out, _ := json.Marshal(obj)
-	blog.Info(string(out))
+	b.clients[connection] = client
+	return client, nil
 }
@@ -0,0 +1,1028 @@
+package os2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os2/fakeecs"
+	"os2/model"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/exp/slices"
+)
+
+// testEnv is a backend on in-memory storage configured against a fake ECS
+type testEnv struct {
+	ctx     context.Context
+	b       *backend
+	storage logical.Storage
+	fake    *fakeecs.Fake
+	server  *httptest.Server
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = logical.TestSystemView()
+	b, err := Factory(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := fakeecs.New(nil)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	env := &testEnv{ctx: ctx, b: b.(*backend), storage: config.StorageView, fake: fake, server: server}
+	env.write(t, "config", map[string]interface{}{
+		"url":      server.URL,
+		"s3_url":   server.URL,
+		"username": fakeecs.DefaultUsername,
+		"password": fakeecs.DefaultPassword,
+		"skip_ssl": true,
+	})
+	return env
+}
+
+// do sends a request and fails the test on an error or an error response
+func (e *testEnv) do(t *testing.T, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	resp, err := e.request(operation, path, data)
+	if err != nil {
+		t.Fatalf("%s %s: %v", operation, path, err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("%s %s: %v", operation, path, resp.Error())
+	}
+	return resp
+}
+
+// doError sends a request expected to fail and returns the error message
+func (e *testEnv) doError(t *testing.T, operation logical.Operation, path string, data map[string]interface{}) string {
+	t.Helper()
+	resp, err := e.request(operation, path, data)
+	if err != nil {
+		return err.Error()
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("%s %s: expected an error, got %v", operation, path, resp)
+	}
+	return resp.Error().Error()
+}
+
+func (e *testEnv) request(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	req := &logical.Request{
+		Operation:  operation,
+		Path:       path,
+		Data:       data,
+		Storage:    e.storage,
+		MountPoint: "os2/",
+	}
+	return e.b.HandleRequest(e.ctx, req)
+}
+
+// write picks create or update through the existence check, the way vault does
+func (e *testEnv) write(t *testing.T, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	checkFound, exists, err := e.b.HandleExistenceCheck(e.ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      path,
+		Data:      data,
+		Storage:   e.storage,
+	})
+	if err != nil {
+		t.Fatalf("existence check of %s: %v", path, err)
+	}
+	if checkFound && exists {
+		return e.do(t, logical.UpdateOperation, path, data)
+	}
+	return e.do(t, logical.CreateOperation, path, data)
+}
+
+func (e *testEnv) revoke(t *testing.T, secret *logical.Secret) {
+	t.Helper()
+	resp, err := e.b.HandleRequest(e.ctx, &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   e.storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("revoking lease: %v %v", err, resp)
+	}
+}
+
+func (e *testEnv) iamUser(namespace, username string) *fakeecs.IamUser {
+	var user *fakeecs.IamUser
+	e.fake.View(func(state *fakeecs.State) {
+		user = state.Namespaces[namespace].IamUsers[username]
+	})
+	return user
+}
+
+func (e *testEnv) objectUser(namespace, username string) *fakeecs.ObjectUser {
+	var user *fakeecs.ObjectUser
+	e.fake.View(func(state *fakeecs.State) {
+		user = state.Namespaces[namespace].ObjectUsers[username]
+	})
+	return user
+}
+
+func TestConfig(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp := env.do(t, logical.ReadOperation, "config", nil)
+	if resp.Data["url"] != env.server.URL || resp.Data["password"] != "<masked>" {
+		t.Fatalf("unexpected config %v", resp.Data)
+	}
+
+	env.do(t, logical.UpdateOperation, "config/rotate", nil)
+	var password string
+	env.fake.View(func(state *fakeecs.State) {
+		password = state.ManagementUsers[fakeecs.DefaultUsername].Password
+	})
+	if password == fakeecs.DefaultPassword {
+		t.Fatal("management password was not rotated on ECS")
+	}
+	if len(password) != defaultPwdLength {
+		t.Fatalf("rotated password is %d characters long", len(password))
+	}
+	config, err := GetConfig(env.ctx, env.storage, defaultConnection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Password != password || config.PendingPassword != "" {
+		t.Fatal("rotated password was not stored")
+	}
+	resp = env.do(t, logical.ReadOperation, "config/rotate", nil)
+	if resp.Data["last_rotated"] == "" {
+		t.Fatal("last_rotated not set")
+	}
+
+	env.fake.Update(func(state *fakeecs.State) {
+		state.ManagementUsers["admin2"] = &fakeecs.ManagementUser{Password: "Secret2!", IsSystemAdmin: true}
+	})
+	env.write(t, "config/dc2", map[string]interface{}{
+		"url":      env.server.URL,
+		"username": "admin2",
+		"password": "Secret2!",
+		"skip_ssl": true,
+	})
+	resp = env.do(t, logical.ListOperation, "config/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("expected 2 connections, got %v", keys)
+	}
+	env.do(t, logical.UpdateOperation, "config/dc2/rotate", nil)
+	env.do(t, logical.DeleteOperation, "config/dc2", nil)
+
+	// config/rotate would shadow a connection named rotate
+	resp, err = env.b.pathConfigWrite(env.ctx, &logical.Request{Storage: env.storage}, &framework.FieldData{
+		Raw: map[string]interface{}{
+			"connection": rotateConnection,
+			"url":        env.server.URL,
+			"username":   fakeecs.DefaultUsername,
+			"password":   fakeecs.DefaultPassword,
+		},
+		Schema: withConnectionField(configFields()),
+	})
+	if err != nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "reserved") {
+		t.Fatalf("connection rotate not rejected: %v %v", resp, err)
+	}
+
+	if resp := env.do(t, logical.ReadOperation, "config", nil); resp.Data["provider"] != model.ProviderEcs {
+		t.Fatalf("unexpected provider %v", resp.Data["provider"])
+	}
+	rgw := map[string]interface{}{
+		"provider": model.ProviderCephRgw,
+		"url":      env.server.URL,
+		"username": "admin",
+		"password": "secret",
+	}
+	if msg := env.doError(t, logical.UpdateOperation, "config", rgw); !strings.Contains(msg, "cannot be changed") {
+		t.Fatalf("unexpected error %q", msg)
+	}
+	rgw["provider"] = "minio"
+	if msg := env.doError(t, logical.CreateOperation, "config/rgw", rgw); !strings.Contains(msg, "provider must be") {
+		t.Fatalf("unexpected error %q", msg)
+	}
+	rgw["provider"] = model.ProviderCephRgw
+	rgw["password_rotation_period"] = 3600
+	if msg := env.doError(t, logical.CreateOperation, "config/rgw", rgw); !strings.Contains(msg, "only supported on ECS") {
+		t.Fatalf("unexpected error %q", msg)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	env := newTestEnv(t)
+	env.do(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, nil)
+	env.fake.ExpireTokens()
+	// the client logs in again on the 401
+	env.do(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, nil)
+}
+
+func TestTimeoutAndCancellation(t *testing.T) {
+	env := newTestEnv(t)
+	slow := httptest.NewServer(fakeecs.Faults{Latency: 5 * time.Second}.Handler(env.fake))
+	t.Cleanup(slow.Close)
+	env.write(t, "config/slow", map[string]interface{}{
+		"url":             slow.URL,
+		"username":        fakeecs.DefaultUsername,
+		"password":        fakeecs.DefaultPassword,
+		"request_timeout": 1,
+	})
+	start := time.Now()
+	msg := env.doError(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, map[string]interface{}{"connection": "slow"})
+	if !strings.Contains(msg, "Timeout") {
+		t.Fatalf("unexpected error %q", msg)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("request_timeout not applied, the request took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(env.ctx)
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	resp, err := env.b.HandleRequest(ctx, &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "namespace/" + fakeecs.DefaultNamespace,
+		Data:       map[string]interface{}{"connection": "slow"},
+		Storage:    env.storage,
+		MountPoint: "os2/",
+	})
+	if err == nil && resp.IsError() {
+		err = resp.Error()
+	}
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("expected the cancelled request to fail, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("cancellation not propagated, the request took %s", elapsed)
+	}
+}
+
+func TestRetryAndCircuitBreaker(t *testing.T) {
+	env := newTestEnv(t)
+	var failures, calls atomic.Int32
+	// failAction restricts the failures to the calls of an iam action when set
+	var failAction atomic.Value
+	failAction.Store("")
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login" {
+			calls.Add(1)
+			action := failAction.Load().(string)
+			if (action == "" || r.URL.Query().Get("Action") == action) && failures.Add(-1) >= 0 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		env.fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(flaky.Close)
+	env.write(t, "config/flaky", map[string]interface{}{
+		"url":               flaky.URL,
+		"username":          fakeecs.DefaultUsername,
+		"password":          fakeecs.DefaultPassword,
+		"max_retries":       2,
+		"max_retry_backoff": 1,
+		"breaker_threshold": 3,
+	})
+	flakyNs := map[string]interface{}{"connection": "flaky"}
+
+	// reads are retried
+	failures.Store(2)
+	env.do(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, flakyNs)
+
+	// creations are not
+	failAction.Store("CreateUser")
+	failures.Store(1)
+	env.doError(t, logical.CreateOperation, "role/flaky_app", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"connection":      "flaky",
+		"credential_type": model.CredentialTypeStaticKeys,
+	})
+	if env.iamUser(fakeecs.DefaultNamespace, "app") != nil {
+		t.Fatal("iam user created despite the failure")
+	}
+	failAction.Store("")
+
+	// three consecutive failed calls open the breaker, the next call fails without reaching ECS
+	env.do(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, flakyNs)
+	failures.Store(3)
+	calls.Store(0)
+	env.doError(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, flakyNs)
+	msg := env.doError(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, flakyNs)
+	if !strings.Contains(msg, "circuit breaker open") || calls.Load() != 3 {
+		t.Fatalf("expected the breaker to be open after 3 calls, got %q after %d calls", msg, calls.Load())
+	}
+}
+
+func TestFailover(t *testing.T) {
+	env := newTestEnv(t)
+	var creates atomic.Int32
+	// node1 fails the user creations after applying them
+	node1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Action") == "CreateUser" {
+			env.fake.ServeHTTP(httptest.NewRecorder(), r)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		env.fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(node1.Close)
+	node2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Action") == "CreateUser" {
+			creates.Add(1)
+		}
+		env.fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(node2.Close)
+	env.write(t, "config/nodes", map[string]interface{}{
+		"url":         node1.URL,
+		"urls":        node2.URL,
+		"username":    fakeecs.DefaultUsername,
+		"password":    fakeecs.DefaultPassword,
+		"max_retries": 0,
+	})
+	// the creation may have been applied by the failing node, it is not sent again to the next one
+	env.doError(t, logical.CreateOperation, "role/nodes_app", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"connection":      "nodes",
+		"credential_type": model.CredentialTypeStaticKeys,
+	})
+	if creates.Load() != 0 {
+		t.Fatal("creation sent again to the next node")
+	}
+	// node1 is marked down, node2 adopts the user created by node1 without creating it again
+	env.write(t, "role/nodes_app", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"connection":      "nodes",
+		"credential_type": model.CredentialTypeStaticKeys,
+	})
+	if creates.Load() != 0 {
+		t.Fatalf("user created again on node2 %d times", creates.Load())
+	}
+}
+
+func TestAssumeRoleFailover(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].Roles = []string{"reader"}
+	})
+	var failSts atomic.Bool
+	node1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failSts.Load() && r.URL.Path == stsPath {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		env.fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(node1.Close)
+	env.write(t, "config/nodes", map[string]interface{}{
+		"url":         node1.URL,
+		"urls":        env.server.URL,
+		"username":    fakeecs.DefaultUsername,
+		"password":    fakeecs.DefaultPassword,
+		"max_retries": 0,
+	})
+	env.write(t, "role/nodes_sts", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"connection":      "nodes",
+		"credential_type": model.CredentialTypeAssumedRole,
+		"role_arn":        "urn:ecs:iam::ns1:role/reader",
+	})
+	// STS calls fail over to the next node like the management calls
+	failSts.Store(true)
+	resp := env.do(t, logical.ReadOperation, "creds/nodes_sts", nil)
+	if !strings.HasPrefix(resp.Data["access_key_id"].(string), "ASIA") {
+		t.Fatalf("unexpected sts creds %v", resp.Data)
+	}
+}
+
+func TestStaticRole(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].Groups = []string{"readers", "writers"}
+	})
+
+	env.write(t, "role/ns1_app", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+		"policy_arns":     "urn:ecs:iam:::policy/ECSS3ReadOnlyAccess",
+		"policy_document": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`,
+		"groups":          "readers",
+		"tags":            "team=storage",
+	})
+	user := env.iamUser(fakeecs.DefaultNamespace, "app")
+	if user == nil || len(user.AccessKeys) != 1 || len(user.AttachedPolicies) != 1 || len(user.InlinePolicies) != 1 {
+		t.Fatalf("iam user not set up: %+v", user)
+	}
+	if len(user.Groups) != 1 || user.Tags["team"] != "storage" {
+		t.Fatalf("groups or tags not set: %+v", user)
+	}
+	resp := env.do(t, logical.ReadOperation, "role/ns1_app", nil)
+	if resp.Data["username"] != "app" || resp.Data["access_key_id_1"] != user.AccessKeys[0].Id {
+		t.Fatalf("unexpected role %v", resp.Data)
+	}
+	if msg := env.doError(t, logical.CreateOperation, "role/ns1_app", map[string]interface{}{"namespace": fakeecs.DefaultNamespace}); !strings.Contains(msg, "already exists") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+
+	// policies, groups and tags are reconciled with ECS
+	env.write(t, "role/ns1_app", map[string]interface{}{
+		"policy_arns": "urn:ecs:iam:::policy/ECSS3FullAccess",
+		"groups":      "writers",
+		"tags":        "team=backup",
+	})
+	user = env.iamUser(fakeecs.DefaultNamespace, "app")
+	if user.AttachedPolicies[0] != "urn:ecs:iam:::policy/ECSS3FullAccess" || user.Groups[0] != "writers" || user.Tags["team"] != "backup" {
+		t.Fatalf("iam user not reconciled: %+v", user)
+	}
+	if msg := env.doError(t, logical.UpdateOperation, "role/ns1_app", map[string]interface{}{"namespace": "ns2"}); !strings.Contains(msg, "cannot be changed") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+
+	// a rotation keeps the previous key until the next one, creds share the newest key
+	oldKey := user.AccessKeys[0].Id
+	env.do(t, logical.UpdateOperation, "rotate-role/ns1_app", nil)
+	user = env.iamUser(fakeecs.DefaultNamespace, "app")
+	if len(user.AccessKeys) != 2 || user.AccessKeys[0].Id != oldKey {
+		t.Fatalf("access key not rotated: %+v", user.AccessKeys)
+	}
+	env.do(t, logical.UpdateOperation, "rotate-role/ns1_app", nil)
+	user = env.iamUser(fakeecs.DefaultNamespace, "app")
+	if len(user.AccessKeys) != 2 || user.AccessKeys[0].Id == oldKey {
+		t.Fatalf("oldest access key not replaced: %+v", user.AccessKeys)
+	}
+	newestKey := user.AccessKeys[1].Id
+	resp = env.do(t, logical.ReadOperation, "creds/ns1_app", nil)
+	if resp.Data["access_key_id"] != newestKey || resp.Secret == nil {
+		t.Fatalf("unexpected creds %v", resp.Data)
+	}
+	// the newest key is shared by every lease, it stays while another lease holds it
+	other := env.do(t, logical.ReadOperation, "creds/ns1_app", nil)
+	env.revoke(t, resp.Secret)
+	if user = env.iamUser(fakeecs.DefaultNamespace, "app"); len(user.AccessKeys) != 2 || user.AccessKeys[1].Id != newestKey {
+		t.Fatalf("key deleted while another lease holds it: %+v", user.AccessKeys)
+	}
+	// once a rotation has replaced it, revoking its last lease deletes the key
+	env.do(t, logical.UpdateOperation, "rotate-role/ns1_app", nil)
+	env.revoke(t, other.Secret)
+	if user = env.iamUser(fakeecs.DefaultNamespace, "app"); len(user.AccessKeys) != 1 || user.AccessKeys[0].Id == newestKey {
+		t.Fatalf("revoked key still on ECS: %+v", user.AccessKeys)
+	}
+	role, err := getRole(env.ctx, env.storage, "ns1_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(role.AccessKeys) != 1 {
+		t.Fatal("revoked key still on the role")
+	}
+	// revoking the last lease of the current key replaces it, so that lease revoke -prefix cuts off access
+	currentKey := user.AccessKeys[0].Id
+	env.revoke(t, env.do(t, logical.ReadOperation, "creds/ns1_app", nil).Secret)
+	if user = env.iamUser(fakeecs.DefaultNamespace, "app"); len(user.AccessKeys) != 1 || user.AccessKeys[0].Id == currentKey {
+		t.Fatalf("current key outlived its leases: %+v", user.AccessKeys)
+	}
+	if resp = env.do(t, logical.ReadOperation, "creds/ns1_app", nil); resp.Data["access_key_id"] != user.AccessKeys[0].Id {
+		t.Fatalf("creds do not use the replacement key: %v", resp.Data)
+	}
+
+	env.do(t, logical.DeleteOperation, "role/ns1_app", nil)
+	if env.iamUser(fakeecs.DefaultNamespace, "app") != nil {
+		t.Fatal("iam user not deleted")
+	}
+	if msg := env.doError(t, logical.ReadOperation, "role/ns1_app", nil); !strings.Contains(msg, "not found") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestRotateRoleCreateFailure(t *testing.T) {
+	env := newTestEnv(t)
+	var failCreate atomic.Bool
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failCreate.Load() && r.URL.Query().Get("Action") == "CreateAccessKey" {
+			http.Error(w, "refused", http.StatusBadRequest)
+			return
+		}
+		env.fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(broken.Close)
+	env.write(t, "config/broken", map[string]interface{}{
+		"url":      broken.URL,
+		"username": fakeecs.DefaultUsername,
+		"password": fakeecs.DefaultPassword,
+	})
+	env.write(t, "role/broken_app", map[string]interface{}{
+		"namespace":  fakeecs.DefaultNamespace,
+		"connection": "broken",
+	})
+	env.do(t, logical.UpdateOperation, "rotate-role/broken_app", nil)
+
+	// the oldest key is deleted before the creation fails, creds must not hand it out
+	failCreate.Store(true)
+	env.doError(t, logical.UpdateOperation, "rotate-role/broken_app", nil)
+	failCreate.Store(false)
+	user := env.iamUser(fakeecs.DefaultNamespace, "app")
+	resp := env.do(t, logical.ReadOperation, "creds/broken_app", nil)
+	if len(user.AccessKeys) != 1 || resp.Data["access_key_id"] != user.AccessKeys[0].Id {
+		t.Fatalf("creds hand out a deleted key: %v, keys %+v", resp.Data, user.AccessKeys)
+	}
+	role, err := getRole(env.ctx, env.storage, "broken_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(role.AccessKeys) != 1 {
+		t.Fatalf("deleted key still on the role: %+v", role.AccessKeys)
+	}
+}
+
+func TestDynamicRole(t *testing.T) {
+	env := newTestEnv(t)
+	env.write(t, "role/ns1_batch", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeDynamicUser,
+		"policy_arns":     "urn:ecs:iam:::policy/ECSS3ReadOnlyAccess",
+		"ttl":             3600,
+	})
+	resp := env.do(t, logical.ReadOperation, "creds/ns1_batch", nil)
+	username := resp.Data["username"].(string)
+	if !strings.HasPrefix(username, "batch-") {
+		t.Fatalf("unexpected dynamic username %s", username)
+	}
+	user := env.iamUser(fakeecs.DefaultNamespace, username)
+	if user == nil || user.AccessKeys[0].Id != resp.Data["access_key_id"] || len(user.AttachedPolicies) != 1 {
+		t.Fatalf("dynamic user not set up: %+v", user)
+	}
+	if resp.Secret.TTL != time.Hour {
+		t.Fatalf("unexpected lease ttl %s", resp.Secret.TTL)
+	}
+	env.revoke(t, resp.Secret)
+	if env.iamUser(fakeecs.DefaultNamespace, username) != nil {
+		t.Fatal("dynamic user not deleted on revoke")
+	}
+	if msg := env.doError(t, logical.CreateOperation, "role/nsx_batch", map[string]interface{}{
+		"namespace":       "nsx",
+		"credential_type": model.CredentialTypeDynamicUser,
+	}); !strings.Contains(msg, "not found") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestAssumedRole(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].Roles = []string{"reader"}
+	})
+	env.write(t, "role/ns1_sts", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeAssumedRole,
+		"role_arn":        "urn:ecs:iam::ns1:role/reader",
+		"ttl":             1800,
+	})
+	resp := env.do(t, logical.ReadOperation, "creds/ns1_sts", nil)
+	if !strings.HasPrefix(resp.Data["access_key_id"].(string), "ASIA") || resp.Data["session_token"] == "" {
+		t.Fatalf("unexpected sts creds %v", resp.Data)
+	}
+	// the backing user only needs the trust policy of the role, not the default policy
+	if user := env.iamUser(fakeecs.DefaultNamespace, "sts"); len(user.AttachedPolicies) != 0 {
+		t.Fatalf("policies attached to the assumed role user: %v", user.AttachedPolicies)
+	}
+
+	env.write(t, "role/ns1_sts2", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeAssumedRole,
+		"role_arn":        "urn:ecs:iam::ns1:role/missing",
+	})
+	if msg := env.doError(t, logical.ReadOperation, "creds/ns1_sts2", nil); !strings.Contains(msg, "NoSuchEntity") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestObjectUserRole(t *testing.T) {
+	env := newTestEnv(t)
+	env.write(t, "role/ns1_legacy", map[string]interface{}{
+		"namespace":                     fakeecs.DefaultNamespace,
+		"user_type":                     model.UserTypeObjectUser,
+		"auth_types":                    "s3,swift",
+		"swift_groups":                  "admin",
+		"existing_key_expiry_time_mins": 60,
+	})
+	user := env.objectUser(fakeecs.DefaultNamespace, "legacy")
+	if user == nil || len(user.SecretKeys) != 1 || user.SwiftPassword == "" || user.SwiftGroups[0] != "admin" {
+		t.Fatalf("object user not set up: %+v", user)
+	}
+	resp := env.do(t, logical.ReadOperation, "creds/ns1_legacy", nil)
+	if resp.Data["secret_access_key"] != user.SecretKeys[0].Secret || resp.Data["swift_password"] != user.SwiftPassword {
+		t.Fatalf("unexpected creds %v", resp.Data)
+	}
+	leased := resp.Secret
+
+	// the previous key stays valid for the grace window
+	env.do(t, logical.UpdateOperation, "rotate-role/ns1_legacy", nil)
+	user = env.objectUser(fakeecs.DefaultNamespace, "legacy")
+	if len(user.SecretKeys) != 2 || user.SecretKeys[0].Expiry.IsZero() || !user.SecretKeys[1].Expiry.IsZero() {
+		t.Fatalf("secret key not rotated with grace: %+v", user.SecretKeys)
+	}
+	newSecret, newPassword := user.SecretKeys[1].Secret, user.SwiftPassword
+	env.revoke(t, leased)
+	user = env.objectUser(fakeecs.DefaultNamespace, "legacy")
+	if len(user.SecretKeys) != 1 || user.SecretKeys[0].Secret != newSecret || user.SwiftPassword != newPassword {
+		t.Fatalf("revoke removed more than the leased key: %+v", user)
+	}
+	// revoking the last lease of the current secret key replaces it and deletes the swift password
+	env.revoke(t, env.do(t, logical.ReadOperation, "creds/ns1_legacy", nil).Secret)
+	user = env.objectUser(fakeecs.DefaultNamespace, "legacy")
+	if len(user.SecretKeys) != 1 || user.SecretKeys[0].Secret == newSecret || user.SwiftPassword != "" {
+		t.Fatalf("current credentials outlived their leases: %+v", user)
+	}
+	resp = env.do(t, logical.ReadOperation, "creds/ns1_legacy", nil)
+	user = env.objectUser(fakeecs.DefaultNamespace, "legacy")
+	if resp.Data["secret_access_key"] != user.SecretKeys[0].Secret || user.SwiftPassword == "" || resp.Data["swift_password"] != user.SwiftPassword || user.SwiftGroups[0] != "admin" {
+		t.Fatalf("creds do not use the replacement credentials: %v, user %+v", resp.Data, user)
+	}
+
+	env.write(t, "role/ns1_legacy", map[string]interface{}{"locked": true})
+	if user = env.objectUser(fakeecs.DefaultNamespace, "legacy"); !user.Locked {
+		t.Fatal("object user not locked")
+	}
+	if msg := env.doError(t, logical.UpdateOperation, "role/ns1_legacy", map[string]interface{}{"groups": "readers"}); msg == "" {
+		t.Fatal("object users must refuse groups")
+	}
+	env.do(t, logical.DeleteOperation, "role/ns1_legacy", nil)
+	if env.objectUser(fakeecs.DefaultNamespace, "legacy") != nil {
+		t.Fatal("object user not deleted")
+	}
+}
+
+func TestRoleImport(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].IamUsers["legacy-app"] = &fakeecs.IamUser{
+			AccessKeys: []*fakeecs.AccessKey{
+				{Id: "AKIAOLD0000000000001", Secret: "old-secret-1", Created: time.Now().Add(-48 * time.Hour)},
+				{Id: "AKIAOLD0000000000002", Secret: "old-secret-2", Created: time.Now().Add(-24 * time.Hour)},
+			},
+		}
+	})
+	env.do(t, logical.UpdateOperation, "role/legacy/import", map[string]interface{}{
+		"namespace":          fakeecs.DefaultNamespace,
+		"username":           "legacy-app",
+		"access_key_secrets": map[string]interface{}{"AKIAOLD0000000000002": "old-secret-2"},
+		"rotate":             true,
+	})
+	user := env.iamUser(fakeecs.DefaultNamespace, "legacy-app")
+	if len(user.AccessKeys) != 2 || user.AccessKeys[0].Id != "AKIAOLD0000000000002" {
+		t.Fatalf("oldest unknown key not replaced: %+v", user.AccessKeys)
+	}
+	resp := env.do(t, logical.ReadOperation, "creds/legacy", nil)
+	if resp.Data["access_key_id"] != user.AccessKeys[1].Id {
+		t.Fatalf("creds do not use the vault owned key: %v", resp.Data)
+	}
+	// a rotation replaces the imported key with no known secret, even when it is the newest
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].IamUsers["shared-app"] = &fakeecs.IamUser{
+			AccessKeys: []*fakeecs.AccessKey{
+				{Id: "AKIAOLD0000000000003", Secret: "old-secret-3", Created: time.Now().Add(-48 * time.Hour)},
+				{Id: "AKIAOLD0000000000004", Secret: "old-secret-4", Created: time.Now().Add(-24 * time.Hour)},
+			},
+		}
+	})
+	env.do(t, logical.UpdateOperation, "role/shared/import", map[string]interface{}{
+		"namespace":          fakeecs.DefaultNamespace,
+		"username":           "shared-app",
+		"access_key_secrets": map[string]interface{}{"AKIAOLD0000000000003": "old-secret-3"},
+	})
+	env.do(t, logical.UpdateOperation, "rotate-role/shared", nil)
+	if user = env.iamUser(fakeecs.DefaultNamespace, "shared-app"); len(user.AccessKeys) != 2 || user.AccessKeys[0].Id != "AKIAOLD0000000000003" {
+		t.Fatalf("rotation did not replace the unknown key: %+v", user.AccessKeys)
+	}
+	// keys imported from RGW come without creation date, they are older than the vault owned ones
+	role := &model.Role{AccessKeys: []*model.AccessKey{
+		{AccessKeyId: "imported", SecretAccessKey: "imported-secret"},
+		{AccessKeyId: "owned", SecretAccessKey: "owned-secret", CreateDate: time.Now().UTC().Format(time.RFC3339)},
+	}}
+	if keyId, err := keyToReplace(role); err != nil || keyId != "imported" {
+		t.Fatalf("undated key not replaced first: %s %v", keyId, err)
+	}
+	if key, err := role.NewestKey(); err != nil || key.AccessKeyId != "owned" {
+		t.Fatalf("undated key taken for the newest: %+v %v", key, err)
+	}
+	if msg := env.doError(t, logical.UpdateOperation, "role/missing/import", map[string]interface{}{
+		"namespace": fakeecs.DefaultNamespace,
+		"username":  "nobody",
+	}); !strings.Contains(msg, "not found") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	env := newTestEnv(t)
+	env.write(t, "role/ns1_owner", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+	})
+	env.write(t, "role/ns1_other", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+	})
+	env.write(t, "bucket/ns1/data", map[string]interface{}{
+		"quota_hard_gb": 100,
+		"quota_soft_gb": 80,
+		"role":          "ns1_owner",
+		"versioning":    true,
+	})
+	resp := env.do(t, logical.ReadOperation, "bucket/ns1/data", nil)
+	if resp.Data["quota_hard_gb"] != int64(100) || resp.Data["role"] != "ns1_owner" || resp.Data["managed"] != true {
+		t.Fatalf("unexpected bucket %v", resp.Data)
+	}
+	var bucket fakeecs.Bucket
+	env.fake.View(func(state *fakeecs.State) {
+		bucket = *state.Namespaces[fakeecs.DefaultNamespace].Buckets["data"]
+	})
+	if bucket.Versioning != "Enabled" || !strings.Contains(bucket.Policy, "urn:ecs:iam::ns1:user/owner") {
+		t.Fatalf("bucket not bound or versioned: %+v", bucket)
+	}
+
+	env.write(t, "bucket/ns1/data", map[string]interface{}{
+		"role":          "ns1_other",
+		"quota_hard_gb": 0,
+		"quota_soft_gb": 0,
+		"retention":     86400,
+	})
+	env.fake.View(func(state *fakeecs.State) {
+		bucket = *state.Namespaces[fakeecs.DefaultNamespace].Buckets["data"]
+	})
+	if strings.Contains(bucket.Policy, "user/owner") || !strings.Contains(bucket.Policy, "user/other") {
+		t.Fatalf("bucket binding not moved: %s", bucket.Policy)
+	}
+	if bucket.BlockSize != -1 || bucket.Retention != 86400 {
+		t.Fatalf("quota or retention not updated: %+v", bucket)
+	}
+	resp = env.do(t, logical.ListOperation, "bucket/ns1/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "data" {
+		t.Fatalf("unexpected buckets %v", keys)
+	}
+	env.do(t, logical.DeleteOperation, "bucket/ns1/data", nil)
+	if resp = env.do(t, logical.ListOperation, "bucket/ns1/", nil); len(resp.Data) != 0 && len(resp.Data["keys"].([]string)) != 0 {
+		t.Fatalf("bucket not deleted: %v", resp.Data)
+	}
+
+	// a creation failing after the bucket exists keeps the steps done so far
+	role, err := getRole(env.ctx, env.storage, "ns1_other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.Name = "ns1_other"
+	role.AccessKeys = nil
+	if err := setRole(env.ctx, env.storage, role); err != nil {
+		t.Fatal(err)
+	}
+	if msg := env.doError(t, logical.CreateOperation, "bucket/ns1/logs", map[string]interface{}{
+		"role":       "ns1_other",
+		"versioning": true,
+	}); !strings.Contains(msg, "enabling versioning failed") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+	resp = env.do(t, logical.ReadOperation, "bucket/ns1/logs", nil)
+	if resp.Data["managed"] != true || resp.Data["role"] != "ns1_other" || resp.Data["versioning"] != false {
+		t.Fatalf("created bucket not recorded: %v", resp.Data)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	env := newTestEnv(t)
+	env.write(t, "namespace/ns2", map[string]interface{}{
+		"admins":                  "alice,bob",
+		"quota_hard_gb":           500,
+		"default_bucket_quota_gb": 50,
+		"retention_classes":       map[string]interface{}{"legal": "720h"},
+	})
+	resp := env.do(t, logical.ReadOperation, "namespace/ns2", nil)
+	if resp.Data["replication_group"] != fakeecs.DefaultReplicationGroup || resp.Data["quota_hard_gb"] != int64(500) {
+		t.Fatalf("unexpected namespace %v", resp.Data)
+	}
+	if resp.Data["retention_classes"].(map[string]int64)["legal"] != int64(30*24*3600) {
+		t.Fatalf("unexpected retention classes %v", resp.Data["retention_classes"])
+	}
+
+	env.write(t, "namespace/ns2", map[string]interface{}{
+		"quota_hard_gb":     0,
+		"retention_classes": map[string]interface{}{"legal": "1h", "audit": "24h"},
+	})
+	resp = env.do(t, logical.ReadOperation, "namespace/ns2", nil)
+	classes := resp.Data["retention_classes"].(map[string]int64)
+	if resp.Data["quota_hard_gb"] != int64(0) || classes["legal"] != 3600 || classes["audit"] != 86400 {
+		t.Fatalf("namespace not updated %v", resp.Data)
+	}
+	resp = env.do(t, logical.ListOperation, "namespace/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("unexpected namespaces %v", keys)
+	}
+
+	env.write(t, "bucket/ns2/kept", nil)
+	env.doError(t, logical.DeleteOperation, "namespace/ns2", nil)
+	env.do(t, logical.DeleteOperation, "bucket/ns2/kept", nil)
+	env.do(t, logical.DeleteOperation, "namespace/ns2", nil)
+	if msg := env.doError(t, logical.ReadOperation, "namespace/ns2", nil); !strings.Contains(msg, "not found") {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestSafe(t *testing.T) {
+	env := newTestEnv(t)
+	for _, roleName := range []string{"ns1_a", "ns1_b"} {
+		env.write(t, "role/"+roleName, map[string]interface{}{
+			"namespace":       fakeecs.DefaultNamespace,
+			"credential_type": model.CredentialTypeStaticKeys,
+			"safe_id":         "safe1",
+		})
+	}
+	env.write(t, "role/ns1_c", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+		"safe_id":         "safe2",
+	})
+
+	resp := env.do(t, logical.ListOperation, "safe/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("unexpected safes %v", keys)
+	}
+	resp = env.do(t, logical.ListOperation, "safe/safe1/roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 || keys[0] != "ns1_a" {
+		t.Fatalf("unexpected safe roles %v", keys)
+	}
+
+	env.do(t, logical.UpdateOperation, "safe/safe1/rotate", nil)
+	if after := env.iamUser(fakeecs.DefaultNamespace, "a").AccessKeys; len(after) != 2 {
+		t.Fatalf("safe roles not rotated: %+v", after)
+	}
+
+	var rotated []string
+	for _, key := range env.iamUser(fakeecs.DefaultNamespace, "b").AccessKeys {
+		rotated = append(rotated, key.Id)
+	}
+	resp = env.do(t, logical.UpdateOperation, "safe/safe1/revoke", nil)
+	if prefixes := resp.Data["lease_prefixes"].([]string); len(prefixes) != 2 || prefixes[0] != "os2/creds/ns1_a/" {
+		t.Fatalf("unexpected lease prefixes %v", resp.Data)
+	}
+	// every handed out key is replaced by a single new one
+	if keys := env.iamUser(fakeecs.DefaultNamespace, "b").AccessKeys; len(keys) != 1 || slices.Contains(rotated, keys[0].Id) {
+		t.Fatalf("safe role keys not revoked: %+v", keys)
+	}
+
+	env.do(t, logical.DeleteOperation, "safe/safe1", nil)
+	if env.iamUser(fakeecs.DefaultNamespace, "a") != nil || env.iamUser(fakeecs.DefaultNamespace, "c") == nil {
+		t.Fatal("safe delete did not delete exactly its roles")
+	}
+	resp = env.do(t, logical.ListOperation, "role/", map[string]interface{}{"safe_id": "safe1"})
+	if len(resp.Data) != 0 && len(resp.Data["keys"].([]string)) != 0 {
+		t.Fatalf("safe index not cleaned up: %v", resp.Data)
+	}
+
+	// revoking the dynamic users of a role leaves alone the static users sharing their prefix
+	env.write(t, "role/ns1_dyn", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeDynamicUser,
+		"safe_id":         "safe3",
+	})
+	env.write(t, "role/ns1_prod", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+		"username":        "dyn-prod",
+		"safe_id":         "safe2",
+	})
+	env.do(t, logical.ReadOperation, "creds/ns1_dyn", nil)
+	resp = env.do(t, logical.UpdateOperation, "safe/safe3/revoke", nil)
+	if result := resp.Data["roles"].(map[string]string)["ns1_dyn"]; result != "deleted 1 dynamic users" {
+		t.Fatalf("unexpected revoke result %q", result)
+	}
+	if env.iamUser(fakeecs.DefaultNamespace, "dyn-prod") == nil {
+		t.Fatal("static user dyn-prod deleted as a dynamic user")
+	}
+
+	// an adopted object user keeps the key vault did not hand out
+	env.fake.Update(func(state *fakeecs.State) {
+		ns := state.Namespaces[fakeecs.DefaultNamespace]
+		if ns.ObjectUsers == nil {
+			ns.ObjectUsers = map[string]*fakeecs.ObjectUser{}
+		}
+		ns.ObjectUsers["adopted"] = &fakeecs.ObjectUser{
+			Created:    time.Now(),
+			SecretKeys: []*fakeecs.SecretKey{{Secret: "external-secret", Created: time.Now().Add(-time.Hour)}},
+		}
+	})
+	env.write(t, "role/ns1_adopted", map[string]interface{}{
+		"namespace": fakeecs.DefaultNamespace,
+		"user_type": model.UserTypeObjectUser,
+		"safe_id":   "safe4",
+	})
+	env.do(t, logical.UpdateOperation, "safe/safe4/revoke", nil)
+	keys := env.objectUser(fakeecs.DefaultNamespace, "adopted").SecretKeys
+	if len(keys) != 2 || keys[0].Secret != "external-secret" {
+		t.Fatalf("safe revoke touched the adopted key: %+v", keys)
+	}
+}
+
+func TestRoleList(t *testing.T) {
+	env := newTestEnv(t)
+	for _, roleName := range []string{"ns1_x", "ns1_y", "ns1_z"} {
+		env.write(t, "role/"+roleName, map[string]interface{}{
+			"namespace":       fakeecs.DefaultNamespace,
+			"credential_type": model.CredentialTypeStaticKeys,
+		})
+	}
+	resp := env.do(t, logical.ListOperation, "role/", map[string]interface{}{"after": "ns1_x", "limit": 1})
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "ns1_y" {
+		t.Fatalf("unexpected page %v", keys)
+	}
+	resp = env.do(t, logical.ListOperation, "role/", map[string]interface{}{"key_info": true, "namespace": "ns1"})
+	info := resp.Data["key_info"].(map[string]interface{})["ns1_z"].(map[string]interface{})
+	if info["username"] != "z" || info["key_count"] != 1 {
+		t.Fatalf("unexpected key info %v", info)
+	}
+	resp = env.do(t, logical.ListOperation, "role/", map[string]interface{}{"min_key_age": 3600})
+	if len(resp.Data) != 0 && len(resp.Data["keys"].([]string)) != 0 {
+		t.Fatalf("no key is an hour old: %v", resp.Data)
+	}
+}
+
+func TestPeriodicRotation(t *testing.T) {
+	env := newTestEnv(t)
+	env.write(t, "role/ns1_due", map[string]interface{}{
+		"namespace":       fakeecs.DefaultNamespace,
+		"credential_type": model.CredentialTypeStaticKeys,
+		"rotation_period": 3600,
+	})
+	role, err := getRole(env.ctx, env.storage, "ns1_due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.Name = "ns1_due"
+	role.NextRotation = time.Now().Add(-time.Minute)
+	if err := setRole(env.ctx, env.storage, role); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.b.periodicFunc(env.ctx, &logical.Request{Storage: env.storage}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := env.iamUser(fakeecs.DefaultNamespace, "due").AccessKeys; len(keys) != 2 {
+		t.Fatalf("due role not rotated: %+v", keys)
+	}
+	if role, err = getRole(env.ctx, env.storage, "ns1_due"); err != nil || !role.NextRotation.After(time.Now()) {
+		t.Fatalf("next rotation not rescheduled: %v", err)
+	}
+
+	// a rotation applied on ECS whose login check failed is promoted whatever the schedule,
+	// and the promotion stands for the rotation that was due
+	env.fake.Update(func(state *fakeecs.State) {
+		state.ManagementUsers[fakeecs.DefaultUsername].Password = "Rotated1!"
+	})
+	config, err := GetConfig(env.ctx, env.storage, defaultConnection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.PendingPassword = "Rotated1!"
+	config.PasswordRotationPeriod = time.Hour
+	config.LastRotated = time.Now().Add(-2 * time.Hour)
+	if err := env.b.persistConfig(env.ctx, defaultConnection, *config, env.storage); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.b.periodicFunc(env.ctx, &logical.Request{Storage: env.storage}); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = GetConfig(env.ctx, env.storage, defaultConnection); err != nil || config.Password != "Rotated1!" || config.PendingPassword != "" {
+		t.Fatalf("pending password not promoted: %v", err)
+	}
+	env.do(t, logical.ReadOperation, "namespace/"+fakeecs.DefaultNamespace, nil)
+}
+
+func TestWALRollback(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.Update(func(state *fakeecs.State) {
+		state.Namespaces[fakeecs.DefaultNamespace].IamUsers["orphan"] = &fakeecs.IamUser{
+			AccessKeys: []*fakeecs.AccessKey{{Id: "AKIAORPHAN0000000001", Secret: "secret", Created: time.Now()}},
+		}
+	})
+	if _, err := framework.PutWAL(env.ctx, env.storage, walDynamicUserKind, &walIamUser{
+		RoleName:  "ns1_batch",
+		Namespace: fakeecs.DefaultNamespace,
+		Username:  "orphan",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	env.do(t, logical.RollbackOperation, "", map[string]interface{}{"immediate": true})
+	if env.iamUser(fakeecs.DefaultNamespace, "orphan") != nil {
+		t.Fatal("rollback did not delete the orphaned dynamic user")
+	}
+	ids, err := framework.ListWAL(env.ctx, env.storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("WAL entries left: %v", ids)
+	}
+}
@@ -0,0 +1,134 @@
+// Command fakeecs serves an in-memory ECS for local development: the management, IAM, STS and S3 calls
+// of the plugin on a single address, with optional state persistence and fault injection.
+//
+//	fakeecs -addr 127.0.0.1:4443 -state ecs.json -latency 200ms -error-rate 0.05
+//	vault write os2/config url=http://127.0.0.1:4443 s3_url=http://127.0.0.1:4443 username=root password='ChangeMe1!' skip_ssl=true
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"os2/fakeecs"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4443", "address to listen on")
+	statePath := flag.String("state", "", "json state file, loaded at start when it exists and saved on shutdown")
+	tlsCert := flag.String("tls-cert", "", "certificate file, serves https together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "private key file of -tls-cert")
+	latency := flag.Duration("latency", 0, "delay added to every request")
+	errorRate := flag.Float64("error-rate", 0, "share of requests, from 0 to 1, answered with a 503")
+	tokenTTL := flag.Duration("token-ttl", fakeecs.DefaultTokenTTL, "lifetime of the management login tokens")
+	expireTokens := flag.Duration("expire-tokens-every", 0, "invalidate every login token at this interval, 0 disables it")
+	verbose := flag.Bool("verbose", false, "log every request")
+	flag.Parse()
+
+	logger := hclog.New(&hclog.LoggerOptions{Name: "fakeecs"})
+	if *errorRate < 0 || *errorRate > 1 {
+		logger.Error("error-rate must be between 0 and 1")
+		os.Exit(2)
+	}
+
+	state := fakeecs.NewState()
+	if *statePath != "" {
+		loaded, err := fakeecs.LoadState(*statePath)
+		switch {
+		case err == nil:
+			state = loaded
+			logger.Info("loaded state", "path", *statePath)
+		case errors.Is(err, os.ErrNotExist):
+			logger.Info("state file not found, starting from the default state", "path", *statePath)
+		default:
+			logger.Error("loading state", "path", *statePath, "error", err)
+			os.Exit(1)
+		}
+	}
+	fake := fakeecs.New(state)
+	fake.SetTokenTTL(*tokenTTL)
+
+	var handler http.Handler = fake
+	handler = fakeecs.Faults{Latency: *latency, ErrorRate: *errorRate}.Handler(handler)
+	if *verbose {
+		handler = logRequests(logger, handler)
+	}
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *expireTokens > 0 {
+		go func() {
+			ticker := time.NewTicker(*expireTokens)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					fake.ExpireTokens()
+					logger.Info("expired login tokens")
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("shutting down", "error", err)
+		}
+	}()
+
+	logger.Info("serving", "addr", *addr, "username", fakeecs.DefaultUsername, "namespace", fakeecs.DefaultNamespace)
+	var err error
+	if *tlsCert != "" || *tlsKey != "" {
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("serving", "error", err)
+		os.Exit(1)
+	}
+
+	if *statePath != "" {
+		if err := fake.SaveState(*statePath); err != nil {
+			logger.Error("saving state", "path", *statePath, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("saved state", "path", *statePath)
+	}
+}
+
+// statusRecorder keeps the status code written by the handler for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(logger hclog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		logger.Info("request", "method", r.Method, "uri", r.URL.RequestURI(), "status", recorder.status, "duration", time.Since(start))
+	})
+}
@@ -2,17 +2,26 @@ package os2
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	pwdGen "github.com/sethvargo/go-password/password"
+	"golang.org/x/exp/slices"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os2/model"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -20,84 +29,183 @@ const (
 	GET          = "GET"
 	POST         = "POST"
 	PUT          = "PUT"
+	DELETE       = "DELETE"
+
+	// name of the inline policy holding a role policy_document
+	inlinePolicyName = "vault-inline-policy"
+	// iam user names are limited to 64 characters
+	maxIamUsernameLength = 64
+	// length of the random suffix of dynamic user names
+	dynamicSuffixLength = 8
+	// number of digits in the random suffix, the rest are lowercase letters
+	dynamicSuffixDigits = 3
+
+	stsPath    = "/sts"
+	stsVersion = "2011-06-15"
+	// STS session names are limited to 64 characters
+	maxSessionNameLength = 64
 )
 
 type ecsClient struct {
-	client   *http.Client
-	username string
-	url      string
-	password string
-	token    string
+	client    *http.Client
+	username  string
+	endpoints *endpoints
+	s3Url     string
+	password  string
+	retry     *retryPolicy
+	// tokenLock guards token, the client is shared by concurrent requests
+	tokenLock sync.RWMutex
+	token     string
 }
 
-func newClient(config *model.PluginConfig) (*ecsClient, error) {
+func newClient(ctx context.Context, config *model.PluginConfig) (*ecsClient, error) {
+	if len(config.Endpoints()) == 0 {
+		return nil, errors.New("no ECS url configured")
+	}
 	client := new(ecsClient)
-	client.url = config.Url
+	client.endpoints = newEndpoints(config.Endpoints())
+	client.s3Url = strings.TrimSuffix(config.S3Url, "/")
 	client.username = config.Username
 	client.password = config.Password
-	client.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipSsl}}}
-	if err := client.login(); err != nil {
-		return nil, err
+	client.client = newHttpClient(config)
+	client.retry = newRetryPolicy(config)
+	if err := client.login(ctx); err != nil {
+		if !isEndpointFailure(ctx, 0, err) || !client.failover(ctx, client.endpoints.url()) {
+			return nil, err
+		}
 	}
 	return client, nil
 }
 
-func (e *ecsClient) createIamUser(namespace, username string) (*model.Role, error) {
-	// check the ns exists
-	found, err := e.checkNsExists(namespace)
+// newHttpClient bounds the time to connect to the object store and the time of each request,
+// so a hung node cannot block the vault request goroutines
+func newHttpClient(config *model.PluginConfig) *http.Client {
+	connectTimeout := config.GetConnectTimeout()
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	return &http.Client{
+		Timeout: config.GetRequestTimeout(),
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: connectTimeout,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: config.SkipSsl},
+		},
+	}
+}
+
+func (e *ecsClient) providerType() string {
+	return model.ProviderEcs
+}
+
+func dynamicUsername(prefix string) (string, error) {
+	suffix, err := pwdGen.Generate(dynamicSuffixLength, dynamicSuffixDigits, 0, true, true)
+	if err != nil {
+		return "", err
+	}
+	return dynamicUsernamePrefix(prefix) + suffix, nil
+}
+
+// dynamicUsernamePrefix is the part shared by the names of all the dynamic users of a role
+func dynamicUsernamePrefix(prefix string) string {
+	if maxLen := maxIamUsernameLength - dynamicSuffixLength - 1; len(prefix) > maxLen {
+		prefix = prefix[:maxLen]
+	}
+	return prefix + "-"
+}
+
+// isDynamicUsername tells whether the user name has the exact shape of the names generated for the role
+// user name, so that a static user sharing the prefix such as app-prod is never taken for a dynamic one
+func isDynamicUsername(prefix, username string) bool {
+	suffix, found := strings.CutPrefix(username, dynamicUsernamePrefix(prefix))
+	if !found || len(suffix) != dynamicSuffixLength {
+		return false
+	}
+	digits := 0
+	for _, c := range suffix {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c < 'a' || c > 'z':
+			return false
+		}
+	}
+	return digits == dynamicSuffixDigits
+}
+
+// assumeRole requests temporary credentials of the iam role, signed with the given access key of an iam user allowed to assume it.
+// It fails over and retries like the management calls, sending AssumeRole again only issues other credentials.
+func (e *ecsClient) assumeRole(ctx context.Context, key *model.AccessKey, roleArn, sessionName string, duration time.Duration) (*model.StsCredentials, error) {
+	var creds *model.StsCredentials
+	err := e.retry.run(ctx, true, func() error {
+		var err error
+		for attempt := 0; attempt < e.endpoints.size(); attempt++ {
+			baseUrl := e.endpoints.url()
+			creds, err = stsAssumeRole(ctx, e.client, baseUrl+stsPath, key, roleArn, sessionName, duration)
+			if !isEndpointFailure(ctx, 0, err) || !e.failover(ctx, baseUrl) {
+				break
+			}
+		}
+		return err
+	})
+	return creds, err
+}
+
+// stsAssumeRole calls the aws style STS AssumeRole action at stsUrl
+func stsAssumeRole(ctx context.Context, client *http.Client, stsUrl string, key *model.AccessKey, roleArn, sessionName string, duration time.Duration) (*model.StsCredentials, error) {
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", stsVersion)
+	form.Set("RoleArn", roleArn)
+	form.Set("RoleSessionName", sessionName)
+	form.Set("DurationSeconds", strconv.Itoa(int(duration.Seconds())))
+	body := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, POST, stsUrl, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	if !found {
-		return nil, fmt.Errorf("namespace %s not found", namespace)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, body, key.AccessKeyId, key.SecretAccessKey, "sts", time.Now())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
 	}
-	// check username not already exists
-	found, err = e.checkIamUserExists(namespace, username)
+	defer resp.Body.Close()
+	bodyByte, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	var key *model.AccessKey
-	if !found {
-		// create iam user
-		key, err = e.createIamUserAndKey(namespace, username)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		keys, err := e.listAccessKeys(namespace, username)
-		if err != nil {
-			return nil, err
-		}
-		if len(keys) > 1 {
-			return nil, fmt.Errorf("user %v has already 2 access keys", username)
-		}
-		// create first or second key
-		key, err = e.createAccessKey(namespace, username)
+	if resp.StatusCode > 300 {
+		return nil, newApiError(resp.StatusCode, string(bodyByte))
 	}
-
-	role := model.Role{
-		Username:   username,
-		AccessKeys: []*model.AccessKey{key},
-		Namespace:  namespace,
-		TTL:        0,
-		MaxTTL:     0,
+	var response model.AssumeRoleResponse
+	if err := xml.Unmarshal(bodyByte, &response); err != nil {
+		return nil, err
 	}
-	return &role, nil
+	return &response.AssumeRoleResult.Credentials, nil
+}
 
+// stsSessionName builds a unique session name showing the vault role in ECS audit logs
+func stsSessionName(roleName string) string {
+	suffix := "-" + strconv.FormatInt(time.Now().Unix(), 10)
+	name := "vault-" + roleName
+	if maxLen := maxSessionNameLength - len(suffix); len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	return name + suffix
 }
 
-func (e *ecsClient) getIamUsers(namespace string) ([]model.IamUser, error) {
+func (e *ecsClient) getIamUsers(ctx context.Context, namespace string) ([]model.IamUser, error) {
 	var allUsers model.ListIamUsers
 	path := "/iam?Action=ListUsers"
-	if err := e.API(GET, path, namespace, nil, &allUsers); err != nil {
+	if err := e.API(ctx, GET, path, namespace, nil, &allUsers); err != nil {
 		return nil, err
 	}
 	return allUsers.ListUsersResult.Users, nil
 }
 
-func (e *ecsClient) checkIamUserExists(namespace, username string) (bool, error) {
+func (e *ecsClient) checkIamUserExists(ctx context.Context, namespace, username string) (bool, error) {
 	path := "/iam?Action=GetUser&UserName=" + username
-	if err := e.API(GET, path, namespace, nil, nil); err != nil {
+	if err := e.API(ctx, GET, path, namespace, nil, nil); err != nil {
 		if apiErr, ok := err.(*ApiError); ok {
 			if apiErr.Code == 404 {
 				return false, nil
@@ -108,41 +216,349 @@ func (e *ecsClient) checkIamUserExists(namespace, username string) (bool, error)
 	return true, nil
 }
 
-func (e *ecsClient) createIamUserAndKey(namespace, username string) (*model.AccessKey, error) {
+// checkRoleSupported accepts every role, ECS iam users have all the role settings
+func (e *ecsClient) checkRoleSupported(role *model.Role) error {
+	return nil
+}
+
+// createIamUserAndKey creates the iam user with the policies, groups and tags of the role
+func (e *ecsClient) createIamUserAndKey(ctx context.Context, namespace, username string, role *model.Role) (*model.AccessKey, error) {
 	path := "/iam?Action=CreateUser&UserName=" + username
-	if err := e.API(POST, path, namespace, nil, nil); err != nil {
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
 		return nil, err
 	}
-	path = "/iam?Action=AttachUserPolicy&PolicyArn=urn:ecs:iam:::policy/ECSS3FullAccess&UserName=" + username
-	if err := e.API(POST, path, namespace, nil, nil); err != nil {
+	for _, policyArn := range role.GetPolicyArns() {
+		if err := e.attachUserPolicy(ctx, namespace, username, policyArn); err != nil {
+			return nil, err
+		}
+	}
+	if role.PolicyDocument != "" {
+		if err := e.putUserPolicy(ctx, namespace, username, role.PolicyDocument); err != nil {
+			return nil, err
+		}
+	}
+	for _, group := range role.Groups {
+		if err := e.addUserToGroup(ctx, namespace, username, group); err != nil {
+			return nil, err
+		}
+	}
+	if len(role.Tags) > 0 {
+		if err := e.tagUser(ctx, namespace, username, role.Tags); err != nil {
+			return nil, err
+		}
+	}
+	return e.createAccessKey(ctx, namespace, username)
+}
+
+// describeIamUser fills the role policies, groups and tags from the current iam user state
+func (e *ecsClient) describeIamUser(ctx context.Context, role *model.Role) error {
+	policyArns, err := e.listAttachedUserPolicies(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	policyDocument, err := e.getUserPolicy(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	groups, err := e.listGroupsForUser(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	tags, err := e.listUserTags(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	role.PolicyArns = policyArns
+	role.PolicyDocument = policyDocument
+	role.Groups = groups
+	if len(tags) > 0 {
+		role.Tags = tags
+	}
+	return nil
+}
+
+// reconcileIamUser brings the iam user policies, groups and tags in line with the role
+// and returns the list of changes applied on ECS
+func (e *ecsClient) reconcileIamUser(ctx context.Context, namespace, username string, role *model.Role) ([]string, error) {
+	var changes []string
+	policyChanges, err := e.reconcileUserPolicies(ctx, namespace, username, role.GetPolicyArns(), role.PolicyDocument)
+	changes = append(changes, policyChanges...)
+	if err != nil {
+		return changes, err
+	}
+	groupChanges, err := e.reconcileUserGroups(ctx, namespace, username, role.Groups)
+	changes = append(changes, groupChanges...)
+	if err != nil {
+		return changes, err
+	}
+	tagChanges, err := e.reconcileUserTags(ctx, namespace, username, role.Tags)
+	changes = append(changes, tagChanges...)
+	return changes, err
+}
+
+// reconcileUserPolicies attaches or detaches managed policies and puts or deletes the inline policy
+// so that the iam user ends up with exactly the given policies
+func (e *ecsClient) reconcileUserPolicies(ctx context.Context, namespace, username string, policyArns []string, policyDocument string) ([]string, error) {
+	var changes []string
+	attached, err := e.listAttachedUserPolicies(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, policyArn := range attached {
+		if !slices.Contains(policyArns, policyArn) {
+			if err := e.detachUserPolicy(ctx, namespace, username, policyArn); err != nil {
+				return changes, err
+			}
+			changes = append(changes, "detached policy "+policyArn)
+		}
+	}
+	for _, policyArn := range policyArns {
+		if !slices.Contains(attached, policyArn) {
+			if err := e.attachUserPolicy(ctx, namespace, username, policyArn); err != nil {
+				return changes, err
+			}
+			changes = append(changes, "attached policy "+policyArn)
+		}
+	}
+	inline, err := e.getUserPolicy(ctx, namespace, username)
+	if err != nil {
+		return changes, err
+	}
+	switch {
+	case policyDocument == "" && inline != "":
+		if err := e.deleteUserPolicy(ctx, namespace, username); err != nil {
+			return changes, err
+		}
+		changes = append(changes, "deleted inline policy")
+	case policyDocument != "" && !sameJSON(inline, policyDocument):
+		if err := e.putUserPolicy(ctx, namespace, username, policyDocument); err != nil {
+			return changes, err
+		}
+		changes = append(changes, "put inline policy")
+	}
+	return changes, nil
+}
+
+func (e *ecsClient) reconcileUserGroups(ctx context.Context, namespace, username string, groups []string) ([]string, error) {
+	var changes []string
+	current, err := e.listGroupsForUser(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range current {
+		if !slices.Contains(groups, group) {
+			if err := e.removeUserFromGroup(ctx, namespace, username, group); err != nil {
+				return changes, err
+			}
+			changes = append(changes, "removed from group "+group)
+		}
+	}
+	for _, group := range groups {
+		if !slices.Contains(current, group) {
+			if err := e.addUserToGroup(ctx, namespace, username, group); err != nil {
+				return changes, err
+			}
+			changes = append(changes, "added to group "+group)
+		}
+	}
+	return changes, nil
+}
+
+func (e *ecsClient) reconcileUserTags(ctx context.Context, namespace, username string, tags map[string]string) ([]string, error) {
+	var changes []string
+	current, err := e.listUserTags(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	var staleKeys []string
+	for key := range current {
+		if _, ok := tags[key]; !ok {
+			staleKeys = append(staleKeys, key)
+		}
+	}
+	if len(staleKeys) > 0 {
+		sort.Strings(staleKeys)
+		if err := e.untagUser(ctx, namespace, username, staleKeys); err != nil {
+			return changes, err
+		}
+		for _, key := range staleKeys {
+			changes = append(changes, "removed tag "+key)
+		}
+	}
+	updated := map[string]string{}
+	for key, value := range tags {
+		if currentValue, ok := current[key]; !ok || currentValue != value {
+			updated[key] = value
+		}
+	}
+	if len(updated) > 0 {
+		if err := e.tagUser(ctx, namespace, username, updated); err != nil {
+			return changes, err
+		}
+		for _, key := range sortedKeys(updated) {
+			changes = append(changes, fmt.Sprintf("set tag %s=%s", key, updated[key]))
+		}
+	}
+	return changes, nil
+}
+
+func (e *ecsClient) attachUserPolicy(ctx context.Context, namespace, username, policyArn string) error {
+	path := "/iam?Action=AttachUserPolicy&PolicyArn=" + url.QueryEscape(policyArn) + "&UserName=" + username
+	return e.API(ctx, POST, path, namespace, nil, nil)
+}
+
+func (e *ecsClient) listAttachedUserPolicies(ctx context.Context, namespace, username string) ([]string, error) {
+	var response model.ListAttachedUserPolicies
+	path := "/iam?Action=ListAttachedUserPolicies&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
+		return nil, err
+	}
+	var policyArns []string
+	for _, policy := range response.ListAttachedUserPoliciesResult.AttachedPolicies {
+		policyArns = append(policyArns, policy.PolicyArn)
+	}
+	return policyArns, nil
+}
+
+func (e *ecsClient) getUserPolicy(ctx context.Context, namespace, username string) (string, error) {
+	var response model.GetUserPolicy
+	path := "/iam?Action=GetUserPolicy&PolicyName=" + inlinePolicyName + "&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return "", nil
+			}
+		}
+		return "", err
+	}
+	// aws style apis return the document url encoded
+	document, err := url.QueryUnescape(response.GetUserPolicyResult.PolicyDocument)
+	if err != nil {
+		return response.GetUserPolicyResult.PolicyDocument, nil
+	}
+	return document, nil
+}
+
+func (e *ecsClient) listGroupsForUser(ctx context.Context, namespace, username string) ([]string, error) {
+	var response model.ListGroupsForUser
+	path := "/iam?Action=ListGroupsForUser&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, group := range response.ListGroupsForUserResult.Groups {
+		groups = append(groups, group.GroupName)
+	}
+	return groups, nil
+}
+
+func (e *ecsClient) addUserToGroup(ctx context.Context, namespace, username, group string) error {
+	path := "/iam?Action=AddUserToGroup&GroupName=" + group + "&UserName=" + username
+	return e.API(ctx, POST, path, namespace, nil, nil)
+}
+
+func (e *ecsClient) removeUserFromGroup(ctx context.Context, namespace, username, group string) error {
+	path := "/iam?Action=RemoveUserFromGroup&GroupName=" + group + "&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *ecsClient) listUserTags(ctx context.Context, namespace, username string) (map[string]string, error) {
+	var response model.ListUserTags
+	path := "/iam?Action=ListUserTags&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
 		return nil, err
 	}
-	return e.createAccessKey(namespace, username)
+	tags := map[string]string{}
+	for _, tag := range response.ListUserTagsResult.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+func (e *ecsClient) tagUser(ctx context.Context, namespace, username string, tags map[string]string) error {
+	path := "/iam?Action=TagUser&UserName=" + username
+	for i, key := range sortedKeys(tags) {
+		path += fmt.Sprintf("&Tags.member.%d.Key=%s&Tags.member.%d.Value=%s", i+1, url.QueryEscape(key), i+1, url.QueryEscape(tags[key]))
+	}
+	return e.API(ctx, POST, path, namespace, nil, nil)
+}
+
+func (e *ecsClient) untagUser(ctx context.Context, namespace, username string, keys []string) error {
+	path := "/iam?Action=UntagUser&UserName=" + username
+	for i, key := range keys {
+		path += fmt.Sprintf("&TagKeys.member.%d=%s", i+1, url.QueryEscape(key))
+	}
+	return e.API(ctx, POST, path, namespace, nil, nil)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameJSON compares two json documents regardless of formatting
+func sameJSON(a, b string) bool {
+	var objA, objB any
+	if json.Unmarshal([]byte(a), &objA) != nil || json.Unmarshal([]byte(b), &objB) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(objA, objB)
+}
+
+func (e *ecsClient) putUserPolicy(ctx context.Context, namespace, username, policyDocument string) error {
+	path := "/iam?Action=PutUserPolicy&PolicyName=" + inlinePolicyName + "&UserName=" + username +
+		"&PolicyDocument=" + url.QueryEscape(policyDocument)
+	return e.API(ctx, POST, path, namespace, nil, nil)
+}
+
+func (e *ecsClient) deleteUserPolicy(ctx context.Context, namespace, username string) error {
+	path := "/iam?Action=DeleteUserPolicy&PolicyName=" + inlinePolicyName + "&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
 }
 
-func (e *ecsClient) createAccessKey(namespace, username string) (*model.AccessKey, error) {
+func (e *ecsClient) createAccessKey(ctx context.Context, namespace, username string) (*model.AccessKey, error) {
 	var response model.CreateAccessKey
 	path := "/iam?Action=CreateAccessKey&UserName=" + username
-	if err := e.API(POST, path, namespace, nil, &response); err != nil {
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
 		return nil, err
 	}
 	key := response.CreateAccessKeyResult.AccessKey
 	return &key, nil
 }
 
-func (e *ecsClient) listAccessKeys(namespace, username string) ([]model.AccessKey, error) {
+func (e *ecsClient) listAccessKeys(ctx context.Context, namespace, username string) ([]model.AccessKey, error) {
 	var response model.ListAccessKeys
 	path := "/iam?Action=ListAccessKeys&UserName=" + username
-	if err := e.API(POST, path, namespace, nil, &response); err != nil {
+	if err := e.API(ctx, POST, path, namespace, nil, &response); err != nil {
 		return nil, err
 	}
 	keys := response.ListAccessKeysResult.AccessKeys
 	return keys, nil
 }
 
-func (e *ecsClient) checkNsExists(name string) (bool, error) {
+func (e *ecsClient) checkNsExists(ctx context.Context, name string) (bool, error) {
 	path := fmt.Sprintf("/object/namespaces/namespace/%s.json", name)
-	if err := e.API(GET, path, "", nil, nil); err != nil {
+	if err := e.API(ctx, GET, path, "", nil, nil); err != nil {
 		if apiErr, ok := err.(*ApiError); ok {
 			if apiErr.Code == 404 {
 				return false, nil
@@ -153,9 +569,9 @@ func (e *ecsClient) checkNsExists(name string) (bool, error) {
 	return true, nil
 }
 
-func (e *ecsClient) deleteIamUser(namespace, username string) error {
+func (e *ecsClient) deleteIamUser(ctx context.Context, namespace, username string) error {
 	path := "/iam?Action=DeleteUser&UserName=" + username
-	if err := e.API(POST, path, namespace, nil, nil); err != nil {
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
 		if apiErr, ok := err.(*ApiError); ok {
 			if apiErr.Code == 404 {
 				return nil
@@ -166,9 +582,51 @@ func (e *ecsClient) deleteIamUser(namespace, username string) error {
 	return nil
 }
 
-func (e *ecsClient) deleteAccessKey(namespace, username, accessKeyId string) error {
+// deleteIamUserAndKeys removes the user access keys and policy before deleting the user itself
+func (e *ecsClient) deleteIamUserAndKeys(ctx context.Context, namespace, username string) error {
+	keys, err := e.listAccessKeys(ctx, namespace, username)
+	if err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return nil
+		}
+		return err
+	}
+	for _, key := range keys {
+		if err := e.deleteAccessKey(ctx, namespace, username, key.AccessKeyId); err != nil {
+			return err
+		}
+	}
+	attached, err := e.listAttachedUserPolicies(ctx, namespace, username)
+	if err != nil {
+		return err
+	}
+	for _, policyArn := range attached {
+		if err := e.detachUserPolicy(ctx, namespace, username, policyArn); err != nil {
+			return err
+		}
+	}
+	if err := e.deleteUserPolicy(ctx, namespace, username); err != nil {
+		return err
+	}
+	return e.deleteIamUser(ctx, namespace, username)
+}
+
+func (e *ecsClient) detachUserPolicy(ctx context.Context, namespace, username, policyArn string) error {
+	path := "/iam?Action=DetachUserPolicy&PolicyArn=" + url.QueryEscape(policyArn) + "&UserName=" + username
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *ecsClient) deleteAccessKey(ctx context.Context, namespace, username, accessKeyId string) error {
 	path := "/iam?Action=DeleteAccessKey&UserName=" + username + "&AccessKeyId=" + accessKeyId
-	if err := e.API(POST, path, namespace, nil, nil); err != nil {
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
 		if apiErr, ok := err.(*ApiError); ok {
 			if apiErr.Code == 404 {
 				return nil
@@ -179,27 +637,45 @@ func (e *ecsClient) deleteAccessKey(namespace, username, accessKeyId string) err
 	return nil
 }
 
-func (e *ecsClient) rotatePwd(username string) (string, error) {
-	gen, err := pwdGen.NewGenerator(&pwdGen.GeneratorInput{
-		Symbols: "!@#$%^&"})
-	if err != nil {
-		return "", err
+func (e *ecsClient) getVdcUser(ctx context.Context, username string) (*model.VdcUser, error) {
+	var user model.VdcUser
+	path := "/vdc/users/" + username + ".json"
+	if err := e.API(ctx, GET, path, "", nil, &user); err != nil {
+		return nil, err
 	}
-	pwd, err := gen.Generate(8, 1, 1, false, false)
+	return &user, nil
+}
+
+// setPwd changes the management user password, keeping its current role flags
+func (e *ecsClient) setPwd(ctx context.Context, username, pwd string) error {
+	current, err := e.getVdcUser(ctx, username)
 	if err != nil {
-		return "", err
+		return err
 	}
 	user := model.VdcUser{
 		Password:        pwd,
-		IsSystemAdmin:   "true",
-		IsSystemMonitor: "false",
-		IsSecurityAdmin: "false",
+		IsSystemAdmin:   current.IsSystemAdmin,
+		IsSystemMonitor: current.IsSystemMonitor,
+		IsSecurityAdmin: current.IsSecurityAdmin,
 	}
 	path := "/vdc/users/" + username + ".json"
-	return pwd, e.API(PUT, path, "", user, nil)
+	return e.API(ctx, PUT, path, "", user, nil)
+}
+
+// checkLogin tells whether the config credentials can log in with the given password
+func checkLogin(ctx context.Context, config model.PluginConfig, pwd string) error {
+	config.Password = pwd
+	_, err := newProvider(ctx, &config)
+	return err
 }
-func (e *ecsClient) login() error {
-	req, err := http.NewRequest(GET, e.url+"/login", nil)
+
+// login gets a token from the current endpoint
+func (e *ecsClient) login(ctx context.Context) error {
+	return e.loginTo(ctx, e.endpoints.url())
+}
+
+func (e *ecsClient) loginTo(ctx context.Context, baseUrl string) error {
+	req, err := http.NewRequestWithContext(ctx, GET, baseUrl+"/login", nil)
 	if err != nil {
 		return err
 	}
@@ -209,8 +685,9 @@ func (e *ecsClient) login() error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return errors.New("ECS login " + strconv.Itoa(resp.StatusCode))
+		return newApiError(resp.StatusCode, "ECS login")
 	}
 	var token string
 	for k, v := range resp.Header {
@@ -222,55 +699,158 @@ func (e *ecsClient) login() error {
 	if token == "" {
 		return errors.New("ECS login X-Sds-Auth-Token header not found")
 	}
+	e.tokenLock.Lock()
 	e.token = token
+	e.tokenLock.Unlock()
 	return nil
 }
 
-func (e *ecsClient) API(method, path, namespace string, data any, obj any) error {
+// failover marks the failed endpoint down and logs in to the next one that answers,
+// it returns false when no other endpoint could be reached
+func (e *ecsClient) failover(ctx context.Context, failedUrl string) bool {
+	for i := 1; i < e.endpoints.size(); i++ {
+		if ctx.Err() != nil {
+			return false
+		}
+		next, ok := e.endpoints.markDown(failedUrl)
+		if !ok {
+			return false
+		}
+		blog.Warn("ECS endpoint failing, switching", "failed", failedUrl, "next", next)
+		if err := e.loginTo(ctx, next); err == nil {
+			return true
+		}
+		failedUrl = next
+	}
+	return false
+}
+
+// isEndpointFailure tells whether the error or status is the node's fault, so another node may succeed.
+// Errors of a cancelled or expired request context are the caller's, they never are.
+func isEndpointFailure(ctx context.Context, status int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			return apiErr.Code >= 500
+		}
+		return true
+	}
+	return status >= 500
+}
+
+// neverSent tells whether the request failed before reaching the node, while connecting or in the TLS handshake
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	return errors.As(err, &recordErr) || errors.As(err, &certErr)
+}
+
+func (e *ecsClient) API(ctx context.Context, method, path, namespace string, data any, obj any) error {
+	var payload []byte
+	if data != nil {
+		payload, _ = json.Marshal(data)
+	}
+	var bodyByte []byte
+	err := e.retry.run(ctx, isIdempotent(method, path), func() error {
+		var err error
+		bodyByte, err = e.callEndpoints(ctx, method, path, namespace, payload)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(bodyByte) > 0 && obj != nil {
+		if err = json.Unmarshal(bodyByte, &obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callEndpoints sends the request to the current endpoint, failing over to the next ones when it fails.
+// Creations are only sent to another node when they never reached the failing one, as it may have applied them.
+func (e *ecsClient) callEndpoints(ctx context.Context, method, path, namespace string, payload []byte) ([]byte, error) {
+	absolute := strings.HasPrefix(path, "http")
+	idempotent := isIdempotent(method, path)
+	var status int
+	var bodyByte []byte
+	var err error
+	for attempt := 0; attempt < e.endpoints.size(); attempt++ {
+		baseUrl := e.endpoints.url()
+		status, bodyByte, err = e.call(ctx, method, baseUrl, path, namespace, payload)
+		if absolute || !isEndpointFailure(ctx, status, err) {
+			break
+		}
+		if !idempotent && !neverSent(err) {
+			// still mark the node down so the next calls go elsewhere
+			e.failover(ctx, baseUrl)
+			break
+		}
+		if !e.failover(ctx, baseUrl) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status > 300 {
+		return nil, newApiError(status, string(bodyByte))
+	}
+	return bodyByte, nil
+}
+
+// call sends the request to the endpoint, logging in again once if the token has expired
+func (e *ecsClient) call(ctx context.Context, method, baseUrl, path, namespace string, payload []byte) (int, []byte, error) {
+	status, body, err := e.send(ctx, method, baseUrl, path, namespace, payload)
+	// if token has expired, we log in again
+	if err == nil && status == 401 {
+		if err := e.loginTo(ctx, baseUrl); err != nil {
+			return 0, nil, err
+		}
+		return e.send(ctx, method, baseUrl, path, namespace, payload)
+	}
+	return status, body, err
+}
+
+func (e *ecsClient) send(ctx context.Context, method, baseUrl, path, namespace string, payload []byte) (int, []byte, error) {
 	if !strings.HasPrefix(path, "http") {
-		path = e.url + path
+		path = baseUrl + path
 	}
 	var req *http.Request
-	if data != nil {
-		payload, _ := json.Marshal(data)
-		req, _ = http.NewRequest(method, path, bytes.NewBuffer(payload))
+	var err error
+	if payload != nil {
+		req, err = http.NewRequestWithContext(ctx, method, path, bytes.NewBuffer(payload))
 	} else {
-		req, _ = http.NewRequest(method, path, nil)
+		req, err = http.NewRequestWithContext(ctx, method, path, nil)
+	}
+	if err != nil {
+		return 0, nil, err
 	}
 
 	if namespace != "" {
 		req.Header = http.Header{nsHeaderName: {namespace}}
 	}
+	e.tokenLock.RLock()
 	req.Header.Add("X-SDS-AUTH-TOKEN", e.token)
+	e.tokenLock.RUnlock()
 	req.Header.Add("Content-Type", "application/json; charset=UTF-8")
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	// if token has expired, we log in again
-	if resp.StatusCode == 401 {
-		if err := e.login(); err != nil {
-			return err
-		}
-		req.Header.Set("X-SDS-AUTH-TOKEN", e.token)
-		resp, err = e.client.Do(req)
-		if err != nil {
-			return err
-		}
-	}
-
 	defer resp.Body.Close()
 	bodyByte, err := io.ReadAll(resp.Body)
-	if resp.StatusCode > 300 {
-		return newApiError(resp.StatusCode, string(bodyByte))
-	}
-
-	if len(bodyByte) > 0 && obj != nil {
-		if err = json.Unmarshal(bodyByte, &obj); err != nil {
-			return err
-		}
+	if err != nil {
+		return 0, nil, err
 	}
-	return nil
+	return resp.StatusCode, bodyByte, nil
 }
 
 type ApiError struct {
@@ -0,0 +1,190 @@
+package os2
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os2/model"
+	"time"
+)
+
+const (
+	bucketPolicyVersion = "2012-10-17"
+	// vault managed bucket policy statements are identified by this sid prefix followed by the role name
+	bucketPolicySidPrefix = "vault-"
+)
+
+func (e *ecsClient) createBucket(ctx context.Context, bucket model.BucketCreate) error {
+	return e.API(ctx, POST, "/object/bucket.json", bucket.Namespace, bucket, nil)
+}
+
+// getBucket returns nil when the bucket does not exist
+func (e *ecsClient) getBucket(ctx context.Context, namespace, name string) (*model.Bucket, error) {
+	var bucket model.Bucket
+	path := fmt.Sprintf("/object/bucket/%s/info.json?namespace=%s", name, namespace)
+	if err := e.API(ctx, GET, path, namespace, nil, &bucket); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (e *ecsClient) listBuckets(ctx context.Context, namespace string) ([]model.Bucket, error) {
+	var buckets model.Buckets
+	path := "/object/bucket.json?namespace=" + namespace
+	if err := e.API(ctx, GET, path, namespace, nil, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets.Bucket, nil
+}
+
+// setBucketQuota removes the quota when both sizes are 0
+func (e *ecsClient) setBucketQuota(ctx context.Context, namespace, name string, hardGb, softGb int64) error {
+	path := fmt.Sprintf("/object/bucket/%s/quota.json", name)
+	if hardGb <= 0 && softGb <= 0 {
+		return e.API(ctx, DELETE, path+"?namespace="+namespace, namespace, nil, nil)
+	}
+	quota := model.BucketQuota{
+		Namespace:        namespace,
+		BlockSize:        hardGb,
+		NotificationSize: softGb,
+	}
+	if quota.BlockSize <= 0 {
+		quota.BlockSize = -1
+	}
+	if quota.NotificationSize <= 0 {
+		quota.NotificationSize = -1
+	}
+	return e.API(ctx, PUT, path, namespace, quota, nil)
+}
+
+func (e *ecsClient) setBucketRetention(ctx context.Context, namespace, name string, retention time.Duration) error {
+	path := fmt.Sprintf("/object/bucket/%s/retention.json", name)
+	return e.API(ctx, PUT, path, namespace, model.BucketRetention{Namespace: namespace, Period: int64(retention.Seconds())}, nil)
+}
+
+func (e *ecsClient) setBucketOwner(ctx context.Context, namespace, name, owner string) error {
+	path := fmt.Sprintf("/object/bucket/%s/owner.json", name)
+	return e.API(ctx, POST, path, namespace, model.BucketOwner{Namespace: namespace, NewOwner: owner}, nil)
+}
+
+// deleteBucket deactivates the bucket, ECS refuses it while the bucket holds objects
+func (e *ecsClient) deleteBucket(ctx context.Context, namespace, name string) error {
+	path := fmt.Sprintf("/object/bucket/%s/deactivate.json?namespace=%s", name, namespace)
+	if err := e.API(ctx, POST, path, namespace, nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *ecsClient) getBucketPolicy(ctx context.Context, namespace, name string) (*model.BucketPolicy, error) {
+	policy := model.BucketPolicy{Version: bucketPolicyVersion}
+	path := fmt.Sprintf("/object/bucket/%s/policy?namespace=%s", name, namespace)
+	if err := e.API(ctx, GET, path, namespace, nil, &policy); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return &policy, nil
+			}
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (e *ecsClient) putBucketPolicy(ctx context.Context, namespace, name string, policy *model.BucketPolicy) error {
+	path := fmt.Sprintf("/object/bucket/%s/policy?namespace=%s", name, namespace)
+	if len(policy.Statement) == 0 {
+		return e.API(ctx, DELETE, path, namespace, nil, nil)
+	}
+	return e.API(ctx, PUT, path, namespace, policy, nil)
+}
+
+// bindBucketUser grants the role user full access to the bucket with a statement owned by the vault role
+func (e *ecsClient) bindBucketUser(ctx context.Context, namespace, name, roleName string, role *model.Role) error {
+	policy, err := e.getBucketPolicy(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	removeStatement(policy, bucketPolicySidPrefix+roleName)
+	policy.Statement = append(policy.Statement, map[string]any{
+		"Sid":       bucketPolicySidPrefix + roleName,
+		"Effect":    "Allow",
+		"Principal": map[string]any{"AWS": []string{bucketPrincipal(role)}},
+		"Action":    []string{"s3:*"},
+		"Resource":  []string{name, name + "/*"},
+	})
+	return e.putBucketPolicy(ctx, namespace, name, policy)
+}
+
+// unbindBucketUser removes the statement of the vault role, leaving the others in place
+func (e *ecsClient) unbindBucketUser(ctx context.Context, namespace, name, roleName string) error {
+	policy, err := e.getBucketPolicy(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if !removeStatement(policy, bucketPolicySidPrefix+roleName) {
+		return nil
+	}
+	return e.putBucketPolicy(ctx, namespace, name, policy)
+}
+
+// bucketPrincipal is the iam user urn, object users are referred to by name
+func bucketPrincipal(role *model.Role) string {
+	if role.IsObjectUser() {
+		return role.Username
+	}
+	return fmt.Sprintf("urn:ecs:iam::%s:user/%s", role.Namespace, role.Username)
+}
+
+func removeStatement(policy *model.BucketPolicy, sid string) bool {
+	for i, statement := range policy.Statement {
+		if statement["Sid"] == sid {
+			policy.Statement = append(policy.Statement[:i], policy.Statement[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// setBucketVersioning goes through the s3 api, there is no management api for it, signed with the given iam user key
+func (e *ecsClient) setBucketVersioning(ctx context.Context, key *model.AccessKey, name string, enabled bool) error {
+	if e.s3Url == "" {
+		return fmt.Errorf("s3_url must be configured to set bucket versioning")
+	}
+	status := "Suspended"
+	if enabled {
+		status = "Enabled"
+	}
+	body, err := xml.Marshal(model.VersioningConfiguration{Status: status})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, PUT, e.s3Url+"/"+name+"?versioning", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	signV4(req, body, key.AccessKeyId, key.SecretAccessKey, "s3", time.Now())
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 300 {
+		bodyByte, _ := io.ReadAll(resp.Body)
+		return newApiError(resp.StatusCode, string(bodyByte))
+	}
+	return nil
+}
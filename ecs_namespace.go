@@ -0,0 +1,121 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"os2/model"
+	"time"
+)
+
+func (e *ecsClient) listNamespaces(ctx context.Context) ([]model.Namespace, error) {
+	var namespaces model.Namespaces
+	if err := e.API(ctx, GET, "/object/namespaces.json", "", nil, &namespaces); err != nil {
+		return nil, err
+	}
+	return namespaces.Namespace, nil
+}
+
+// getNamespace returns nil when the namespace does not exist
+func (e *ecsClient) getNamespace(ctx context.Context, name string) (*model.Namespace, error) {
+	var namespace model.Namespace
+	path := fmt.Sprintf("/object/namespaces/namespace/%s.json", name)
+	if err := e.API(ctx, GET, path, "", nil, &namespace); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+	return &namespace, nil
+}
+
+func (e *ecsClient) createNamespace(ctx context.Context, namespace model.NamespaceCreate) error {
+	return e.API(ctx, POST, "/object/namespaces/namespace.json", "", namespace, nil)
+}
+
+func (e *ecsClient) updateNamespace(ctx context.Context, name string, namespace model.NamespaceUpdate) error {
+	path := fmt.Sprintf("/object/namespaces/namespace/%s.json", name)
+	return e.API(ctx, PUT, path, "", namespace, nil)
+}
+
+// deleteNamespace deactivates the namespace, ECS refuses it while the namespace holds buckets
+func (e *ecsClient) deleteNamespace(ctx context.Context, name string) error {
+	path := fmt.Sprintf("/object/namespaces/namespace/%s/deactivate.json", name)
+	if err := e.API(ctx, POST, path, "", nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *ecsClient) getNamespaceQuota(ctx context.Context, name string) (*model.NamespaceQuota, error) {
+	var quota model.NamespaceQuota
+	path := fmt.Sprintf("/object/namespaces/namespace/%s/quota.json", name)
+	if err := e.API(ctx, GET, path, "", nil, &quota); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// setNamespaceQuota removes the quota when both sizes are 0
+func (e *ecsClient) setNamespaceQuota(ctx context.Context, name string, hardGb, softGb int64) error {
+	path := fmt.Sprintf("/object/namespaces/namespace/%s/quota.json", name)
+	if hardGb <= 0 && softGb <= 0 {
+		return e.API(ctx, DELETE, path, "", nil, nil)
+	}
+	quota := model.NamespaceQuota{
+		Namespace:        name,
+		BlockSize:        hardGb,
+		NotificationSize: softGb,
+	}
+	if quota.BlockSize <= 0 {
+		quota.BlockSize = -1
+	}
+	if quota.NotificationSize <= 0 {
+		quota.NotificationSize = -1
+	}
+	return e.API(ctx, PUT, path, "", quota, nil)
+}
+
+func (e *ecsClient) listRetentionClasses(ctx context.Context, name string) ([]model.RetentionClass, error) {
+	var classes model.RetentionClasses
+	path := fmt.Sprintf("/object/namespaces/namespace/%s/retention.json", name)
+	if err := e.API(ctx, GET, path, "", nil, &classes); err != nil {
+		return nil, err
+	}
+	return classes.RetentionClass, nil
+}
+
+// setRetentionClasses creates the missing classes and updates the periods of the others,
+// ECS cannot delete retention classes so the ones not given are left in place
+func (e *ecsClient) setRetentionClasses(ctx context.Context, name string, classes map[string]time.Duration) error {
+	existing, err := e.listRetentionClasses(ctx, name)
+	if err != nil {
+		return err
+	}
+	periods := map[string]int64{}
+	for _, class := range existing {
+		periods[class.Name] = class.Period
+	}
+	for _, className := range sortedKeys(classes) {
+		period := int64(classes[className].Seconds())
+		current, found := periods[className]
+		if !found {
+			path := fmt.Sprintf("/object/namespaces/namespace/%s/retention.json", name)
+			if err := e.API(ctx, POST, path, "", model.RetentionClass{Name: className, Period: period}, nil); err != nil {
+				return err
+			}
+		} else if current != period {
+			path := fmt.Sprintf("/object/namespaces/namespace/%s/retention/%s.json", name, className)
+			if err := e.API(ctx, PUT, path, "", model.RetentionClass{Period: period}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
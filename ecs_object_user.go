@@ -0,0 +1,230 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"os2/model"
+	"sort"
+	"time"
+)
+
+const (
+	// layout of the key timestamps returned by the object user secret key api
+	ecsTimestampLayout = "2006-01-02 15:04:05.000"
+	// keys created within the same second must keep their order once converted
+	rfc3339Millis = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// createObjectUser creates the object user of the role, or adopts it, and gives it a new secret key
+func (e *ecsClient) createObjectUser(ctx context.Context, role *model.Role) error {
+	found, err := e.checkNsExists(ctx, role.Namespace)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("namespace %s not found", role.Namespace)
+	}
+	found, err = e.checkObjectUserExists(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	if found {
+		keys, err := e.listSecretKeys(ctx, role.Namespace, role.Username)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 1 {
+			return fmt.Errorf("object user %v has already 2 secret keys", role.Username)
+		}
+	} else {
+		user := model.ObjectUser{User: role.Username, Namespace: role.Namespace}
+		if err := e.API(ctx, POST, "/object/users.json", role.Namespace, user, nil); err != nil {
+			return err
+		}
+	}
+	if role.HasS3() {
+		// an adopted user keeps its current key, vault only owns the one it creates
+		key, err := e.createSecretKey(ctx, role.Namespace, role.Username, 0)
+		if err != nil {
+			return err
+		}
+		role.AccessKeys = []*model.AccessKey{key}
+	}
+	if role.HasSwift() {
+		if err := e.rotateSwiftPassword(ctx, role); err != nil {
+			return err
+		}
+	}
+	if role.Locked {
+		if err := e.lockObjectUser(ctx, role.Namespace, role.Username, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ecsClient) checkObjectUserExists(ctx context.Context, namespace, username string) (bool, error) {
+	path := fmt.Sprintf("/object/users/%s/info.json?namespace=%s", username, namespace)
+	if err := e.API(ctx, GET, path, namespace, nil, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return false, nil
+			}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// createSecretKey adds a secret key to the object user, the existing key stays valid expiryMins minutes
+func (e *ecsClient) createSecretKey(ctx context.Context, namespace, username string, expiryMins int) (*model.AccessKey, error) {
+	var created model.SecretKeyCreated
+	path := fmt.Sprintf("/object/user-secret-keys/%s.json", username)
+	data := model.SecretKeyCreate{Namespace: namespace, ExistingKeyExpiryTimeMins: expiryMins}
+	if err := e.API(ctx, POST, path, namespace, data, &created); err != nil {
+		return nil, err
+	}
+	return secretKey(username, created.SecretKey, created.KeyTimestamp, ""), nil
+}
+
+// listSecretKeys returns the secret keys of the object user, oldest first
+func (e *ecsClient) listSecretKeys(ctx context.Context, namespace, username string) ([]*model.AccessKey, error) {
+	var secretKeys model.ObjectUserSecretKeys
+	path := fmt.Sprintf("/object/user-secret-keys/%s.json?namespace=%s", username, namespace)
+	if err := e.API(ctx, GET, path, namespace, nil, &secretKeys); err != nil {
+		return nil, err
+	}
+	var keys []*model.AccessKey
+	if secretKeys.SecretKey1 != "" {
+		keys = append(keys, secretKey(username, secretKeys.SecretKey1, secretKeys.KeyTimestamp1, secretKeys.KeyExpiryTimestamp1))
+	}
+	if secretKeys.SecretKey2 != "" {
+		keys = append(keys, secretKey(username, secretKeys.SecretKey2, secretKeys.KeyTimestamp2, secretKeys.KeyExpiryTimestamp2))
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreateDate < keys[j].CreateDate
+	})
+	return keys, nil
+}
+
+func (e *ecsClient) deleteSecretKey(ctx context.Context, namespace, username, secret string) error {
+	path := fmt.Sprintf("/object/user-secret-keys/%s/deactivate.json", username)
+	data := model.SecretKeyDeactivate{Namespace: namespace, SecretKey: secret}
+	if err := e.API(ctx, POST, path, namespace, data, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// rotateSecretKey creates a new secret key, the previous one stays valid expiryMins minutes or is deleted right away when 0
+func (e *ecsClient) rotateSecretKey(ctx context.Context, namespace, username string, expiryMins int) ([]*model.AccessKey, error) {
+	keys, err := e.listSecretKeys(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 1 {
+		// ECS holds 2 keys at most, the oldest one goes even if its grace window is not over
+		if err := e.deleteSecretKey(ctx, namespace, username, keys[0].SecretAccessKey); err != nil {
+			return nil, err
+		}
+		keys = keys[1:]
+	}
+	if _, err := e.createSecretKey(ctx, namespace, username, expiryMins); err != nil {
+		return nil, err
+	}
+	if expiryMins <= 0 {
+		for _, key := range keys {
+			if err := e.deleteSecretKey(ctx, namespace, username, key.SecretAccessKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e.listSecretKeys(ctx, namespace, username)
+}
+
+// rotateSwiftPassword sets a new swift password on the object user, with the role swift groups
+func (e *ecsClient) rotateSwiftPassword(ctx context.Context, role *model.Role) error {
+	pwd, err := generateSwiftPwd()
+	if err != nil {
+		return err
+	}
+	if err := e.setSwiftPassword(ctx, role.Namespace, role.Username, pwd, role.SwiftGroups); err != nil {
+		return err
+	}
+	role.SwiftPassword = pwd
+	role.SwiftLeases = 0
+	return nil
+}
+
+func (e *ecsClient) setSwiftPassword(ctx context.Context, namespace, username, pwd string, groups []string) error {
+	path := fmt.Sprintf("/object/user-password/%s.json", username)
+	data := model.UserPassword{Namespace: namespace, Password: pwd, Groups: groups}
+	return e.API(ctx, PUT, path, namespace, data, nil)
+}
+
+func (e *ecsClient) deleteSwiftPassword(ctx context.Context, namespace, username string) error {
+	path := fmt.Sprintf("/object/user-password/%s/deactivate.json", username)
+	if err := e.API(ctx, POST, path, namespace, model.UserPassword{Namespace: namespace}, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *ecsClient) lockObjectUser(ctx context.Context, namespace, username string, locked bool) error {
+	data := model.ObjectUserLock{User: username, Namespace: namespace, IsLocked: locked}
+	return e.API(ctx, PUT, "/object/users/lock.json", namespace, data, nil)
+}
+
+func (e *ecsClient) deleteObjectUser(ctx context.Context, namespace, username string) error {
+	data := model.ObjectUser{User: username, Namespace: namespace}
+	if err := e.API(ctx, POST, "/object/users/deactivate.json", namespace, data, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			if apiErr.Code == 404 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// deleteUser deletes the iam user or object user of a role
+func (e *ecsClient) deleteUser(ctx context.Context, userType, namespace, username string) error {
+	if userType == model.UserTypeObjectUser {
+		return e.deleteObjectUser(ctx, namespace, username)
+	}
+	return e.deleteIamUserAndKeys(ctx, namespace, username)
+}
+
+// secretKey maps an object user secret key on an access key, the access key id of object users is their name
+func secretKey(username, secret, timestamp, expiry string) *model.AccessKey {
+	return &model.AccessKey{
+		AccessKeyId:     username,
+		UserName:        username,
+		SecretAccessKey: secret,
+		CreateDate:      ecsTimestamp(timestamp),
+		ExpiryDate:      ecsTimestamp(expiry),
+	}
+}
+
+// ecsTimestamp converts the key timestamps to the RFC3339 dates used for iam access keys
+func ecsTimestamp(timestamp string) string {
+	if timestamp == "" {
+		return ""
+	}
+	t, err := time.Parse(ecsTimestampLayout, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.UTC().Format(rfc3339Millis)
+}
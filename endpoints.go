@@ -0,0 +1,72 @@
+package os2
+
+import (
+	"sync"
+	"time"
+)
+
+// endpointCooldown is how long a failing ECS node is skipped before being tried again
+const endpointCooldown = 30 * time.Second
+
+type endpoint struct {
+	url       string
+	downUntil time.Time
+}
+
+// endpoints tracks the health of the ECS nodes of a connection, requests go to the current one
+type endpoints struct {
+	lock    sync.Mutex
+	list    []*endpoint
+	current int
+}
+
+func newEndpoints(urls []string) *endpoints {
+	e := &endpoints{}
+	for _, url := range urls {
+		e.list = append(e.list, &endpoint{url: url})
+	}
+	return e
+}
+
+func (e *endpoints) url() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.list[e.current].url
+}
+
+func (e *endpoints) size() int {
+	return len(e.list)
+}
+
+// markDown flags the url as failing and switches to the next healthy endpoint, or the one down for the longest time.
+// It returns false when there is no other endpoint to switch to.
+func (e *endpoints) markDown(url string) (string, bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	now := time.Now()
+	for _, ep := range e.list {
+		if ep.url == url {
+			ep.downUntil = now.Add(endpointCooldown)
+		}
+	}
+	if e.list[e.current].url != url {
+		// another request already failed over
+		return e.list[e.current].url, true
+	}
+	next := -1
+	for i := 1; i < len(e.list); i++ {
+		candidate := (e.current + i) % len(e.list)
+		if now.After(e.list[candidate].downUntil) {
+			next = candidate
+			break
+		}
+		if next == -1 || e.list[candidate].downUntil.Before(e.list[next].downUntil) {
+			next = candidate
+		}
+	}
+	if next == -1 {
+		return url, false
+	}
+	e.current = next
+	return e.list[next].url, true
+}
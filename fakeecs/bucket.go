@@ -0,0 +1,191 @@
+package fakeecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// buckets serves /object/bucket.json and /object/bucket/...
+func (f *Fake) buckets(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	nsName := r.URL.Query().Get("namespace")
+	if path == "/object/bucket.json" {
+		switch r.Method {
+		case http.MethodGet:
+			ns, ok := f.state.Namespaces[nsName]
+			if !ok {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Namespace %s not found", nsName))
+				return
+			}
+			buckets := []map[string]any{}
+			for _, name := range sortedNames(ns.Buckets) {
+				buckets = append(buckets, bucketInfo(nsName, name, ns.Buckets[name]))
+			}
+			writeJSON(w, map[string]any{"object_bucket": buckets})
+		case http.MethodPost:
+			f.createBucket(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+		}
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "/object/bucket/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+		return
+	}
+	name, sub, _ := strings.Cut(rest, "/")
+	sub = strings.TrimSuffix(sub, ".json")
+	bucketNs, bucket := f.state.bucket(name)
+	if bucket == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Bucket %s not found", name))
+		return
+	}
+	switch {
+	case sub == "info" && r.Method == http.MethodGet:
+		if nsName != "" && nsName != bucketNs {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Bucket %s not found in namespace %s", name, nsName))
+			return
+		}
+		writeJSON(w, bucketInfo(bucketNs, name, bucket))
+	case sub == "deactivate" && r.Method == http.MethodPost:
+		delete(f.state.Namespaces[bucketNs].Buckets, name)
+		w.WriteHeader(http.StatusOK)
+	case sub == "quota" && r.Method == http.MethodPut:
+		var quota struct {
+			BlockSize        int64 `json:"blockSize"`
+			NotificationSize int64 `json:"notificationSize"`
+		}
+		if !readJSON(w, r, &quota) {
+			return
+		}
+		if quota.BlockSize > 0 && quota.NotificationSize > quota.BlockSize {
+			writeError(w, http.StatusBadRequest, "notificationSize must not exceed blockSize")
+			return
+		}
+		bucket.BlockSize, bucket.NotificationSize = quota.BlockSize, quota.NotificationSize
+		w.WriteHeader(http.StatusOK)
+	case sub == "quota" && r.Method == http.MethodDelete:
+		bucket.BlockSize, bucket.NotificationSize = -1, -1
+		w.WriteHeader(http.StatusOK)
+	case sub == "retention" && r.Method == http.MethodPut:
+		var retention struct {
+			Period int64 `json:"period"`
+		}
+		if !readJSON(w, r, &retention) {
+			return
+		}
+		bucket.Retention = retention.Period
+		w.WriteHeader(http.StatusOK)
+	case sub == "owner" && r.Method == http.MethodPost:
+		var owner struct {
+			NewOwner string `json:"new_owner"`
+		}
+		if !readJSON(w, r, &owner) {
+			return
+		}
+		if _, ok := f.state.Namespaces[bucketNs].ObjectUsers[owner.NewOwner]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Object user %s not found", owner.NewOwner))
+			return
+		}
+		bucket.Owner = owner.NewOwner
+		w.WriteHeader(http.StatusOK)
+	case sub == "policy" && r.Method == http.MethodGet:
+		if bucket.Policy == "" {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Bucket %s has no policy", name))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, bucket.Policy)
+	case sub == "policy" && r.Method == http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !validBucketPolicy(body) {
+			writeError(w, http.StatusBadRequest, "Invalid bucket policy")
+			return
+		}
+		bucket.Policy = string(body)
+		w.WriteHeader(http.StatusOK)
+	case sub == "policy" && r.Method == http.MethodDelete:
+		bucket.Policy = ""
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+	}
+}
+
+func (f *Fake) createBucket(w http.ResponseWriter, r *http.Request) {
+	var create struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Vpool     string `json:"vpool"`
+		Owner     string `json:"owner"`
+		Retention int64  `json:"retention"`
+	}
+	if !readJSON(w, r, &create) {
+		return
+	}
+	ns, ok := f.state.Namespaces[create.Namespace]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Namespace %s not found", create.Namespace))
+		return
+	}
+	if create.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if _, existing := f.state.bucket(create.Name); existing != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Bucket %s already exists", create.Name))
+		return
+	}
+	if create.Vpool == "" {
+		create.Vpool = ns.DefaultVpool
+	}
+	if !slices.Contains(f.state.ReplicationGroups, create.Vpool) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Replication group %s not found", create.Vpool))
+		return
+	}
+	if create.Owner != "" {
+		if _, ok := ns.ObjectUsers[create.Owner]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Object user %s not found", create.Owner))
+			return
+		}
+	}
+	ns.Buckets[create.Name] = &Bucket{
+		Owner:            create.Owner,
+		Vpool:            create.Vpool,
+		Created:          f.now(),
+		BlockSize:        ns.DefaultBucketBlockSize,
+		NotificationSize: -1,
+		Retention:        create.Retention,
+	}
+	writeJSON(w, map[string]string{"id": create.Name, "name": create.Name})
+}
+
+func bucketInfo(nsName, name string, bucket *Bucket) map[string]any {
+	return map[string]any{
+		"name":              name,
+		"namespace":         nsName,
+		"vpool":             bucket.Vpool,
+		"owner":             bucket.Owner,
+		"block_size":        bucket.BlockSize,
+		"notification_size": bucket.NotificationSize,
+		"retention":         bucket.Retention,
+		"created":           bucket.Created.Format(time.RFC3339),
+	}
+}
+
+// validBucketPolicy checks the document is json with a non empty list of statements
+func validBucketPolicy(body []byte) bool {
+	var policy struct {
+		Statement []map[string]any `json:"Statement"`
+	}
+	if err := json.Unmarshal(body, &policy); err != nil {
+		return false
+	}
+	return len(policy.Statement) > 0
+}
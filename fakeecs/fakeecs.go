@@ -0,0 +1,252 @@
+// Package fakeecs is an in-memory Dell ECS serving the management, IAM, STS and S3 calls of the plugin,
+// so the backend can be exercised without a live cluster.
+package fakeecs
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenTTL is how long a login token stays valid, ECS expires idle tokens after 2 hours
+	DefaultTokenTTL = 2 * time.Hour
+
+	tokenHeader     = "X-SDS-AUTH-TOKEN"
+	namespaceHeader = "x-emc-namespace"
+
+	// layout of the object user secret key timestamps
+	ecsTimestampLayout = "2006-01-02 15:04:05.000"
+	// layout of the iam dates, with milliseconds so that keys created in a row stay ordered
+	iamDateLayout = "2006-01-02T15:04:05.000Z07:00"
+
+	maxAccessKeys = 2
+	maxSecretKeys = 2
+)
+
+// Fake is an http.Handler holding the ECS state, safe for concurrent use
+type Fake struct {
+	lock     sync.Mutex
+	state    *State
+	tokens   map[string]time.Time
+	tokenTTL time.Duration
+	// last is the last time handed out, see now
+	last time.Time
+}
+
+// New returns a fake serving the given state, the default state when nil
+func New(state *State) *Fake {
+	if state == nil {
+		state = NewState()
+	}
+	state.init()
+	return &Fake{
+		state:    state,
+		tokens:   map[string]time.Time{},
+		tokenTTL: DefaultTokenTTL,
+	}
+}
+
+// SetTokenTTL changes the lifetime of the tokens issued from now on
+func (f *Fake) SetTokenTTL(ttl time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.tokenTTL = ttl
+}
+
+// ExpireTokens invalidates every issued token, the next calls get a 401 until they log in again
+func (f *Fake) ExpireTokens() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.tokens = map[string]time.Time{}
+}
+
+// View runs fn with the state locked, fn must not keep references to it
+func (f *Fake) View(fn func(state *State)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	fn(f.state)
+}
+
+// Update runs fn with the state locked so tests can set up or alter it
+func (f *Fake) Update(fn func(state *State)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	fn(f.state)
+	f.state.init()
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/login":
+		f.login(w, r)
+		return
+	case path == "/sts":
+		f.sts(w, r)
+		return
+	case !strings.HasPrefix(path, "/object/") && !strings.HasPrefix(path, "/vdc/") && path != "/iam":
+		// anything else is the s3 api
+		f.s3(w, r)
+		return
+	}
+	if !f.authenticated(r) {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	switch {
+	case path == "/iam":
+		f.iam(w, r)
+	case strings.HasPrefix(path, "/vdc/users/"):
+		f.vdcUser(w, r)
+	case strings.HasPrefix(path, "/object/namespaces"):
+		f.namespaces(w, r)
+	case strings.HasPrefix(path, "/object/bucket"):
+		f.buckets(w, r)
+	case strings.HasPrefix(path, "/object/users"), strings.HasPrefix(path, "/object/user-secret-keys/"),
+		strings.HasPrefix(path, "/object/user-password/"):
+		f.objectUsers(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+	}
+}
+
+func (f *Fake) login(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	user, found := f.state.ManagementUsers[username]
+	if !ok || !found || user.Password != password {
+		writeError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	token := randomString(alphanumeric, 32)
+	f.tokens[token] = time.Now().Add(f.tokenTTL)
+	w.Header().Set(tokenHeader, token)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *Fake) authenticated(r *http.Request) bool {
+	token := r.Header.Get(tokenHeader)
+	expiry, ok := f.tokens[token]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(f.tokens, token)
+		return false
+	}
+	return true
+}
+
+func (f *Fake) vdcUser(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/vdc/users/"), ".json")
+	user, ok := f.state.ManagementUsers[username]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Management user "+username+" not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, map[string]any{
+			"userId":          username,
+			"isSystemAdmin":   user.IsSystemAdmin,
+			"isSystemMonitor": user.IsSystemMonitor,
+			"isSecurityAdmin": user.IsSecurityAdmin,
+		})
+	case http.MethodPut:
+		var update struct {
+			Password string `json:"password"`
+		}
+		if !readJSON(w, r, &update) {
+			return
+		}
+		if update.Password != "" {
+			user.Password = update.Password
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	}
+}
+
+// now is strictly increasing so that resources created in a row never share a timestamp
+func (f *Fake) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(f.last) {
+		now = f.last.Add(time.Millisecond)
+	}
+	f.last = now
+	return now
+}
+
+// ecsError is the error body of the management api
+type ecsError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+	Details     string `json:"details"`
+	Retryable   bool   `json:"retryable"`
+}
+
+func writeError(w http.ResponseWriter, status int, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ecsError{
+		Code:        status,
+		Description: http.StatusText(status),
+		Details:     details,
+		Retryable:   status >= 500,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeXML(w http.ResponseWriter, obj any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(obj)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, obj any) bool {
+	if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+const (
+	alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	upperDigits  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+func randomString(charset string, length int) string {
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = charset[n.Int64()]
+	}
+	return string(out)
+}
+
+func randomSecret() string {
+	buf := make([]byte, 30)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
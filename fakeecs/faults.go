@@ -0,0 +1,36 @@
+package fakeecs
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Faults are the failures injected in front of a handler to exercise the client error paths
+type Faults struct {
+	// Latency delays every request
+	Latency time.Duration
+	// ErrorRate is the share of requests, from 0 to 1, answered with a 503 without reaching the handler
+	ErrorRate float64
+}
+
+// Handler wraps next with the faults, it returns next as is when there are none
+func (faults Faults) Handler(next http.Handler) http.Handler {
+	if faults.Latency <= 0 && faults.ErrorRate <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if faults.Latency > 0 {
+			select {
+			case <-time.After(faults.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if faults.ErrorRate > 0 && rand.Float64() < faults.ErrorRate {
+			writeError(w, http.StatusServiceUnavailable, "Injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,277 @@
+package fakeecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const maxUserTags = 50
+
+// iamError is the aws style error body of the iam api
+type iamError struct {
+	Error struct {
+		Code    string `json:"Code"`
+		Message string `json:"Message"`
+		Type    string `json:"Type"`
+	} `json:"Error"`
+}
+
+func writeIamError(w http.ResponseWriter, status int, code, message string) {
+	var body iamError
+	body.Error.Code = code
+	body.Error.Message = message
+	body.Error.Type = "Sender"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeIamResult wraps the result the way the aws apis do, under <Action>Result
+func writeIamResult(w http.ResponseWriter, action string, result any) {
+	response := map[string]any{
+		"ResponseMetadata": map[string]string{"RequestId": randomString(upperDigits, 16)},
+	}
+	if result != nil {
+		response[action+"Result"] = result
+	}
+	writeJSON(w, response)
+}
+
+func (f *Fake) iam(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if err := r.ParseForm(); err == nil {
+		for key, values := range r.PostForm {
+			params[key] = values
+		}
+	}
+	nsName := r.Header.Get(namespaceHeader)
+	ns, ok := f.state.Namespaces[nsName]
+	if !ok {
+		writeIamError(w, http.StatusBadRequest, "InvalidParameterValue", fmt.Sprintf("namespace %q does not exist", nsName))
+		return
+	}
+	action := params.Get("Action")
+	if action == "ListUsers" {
+		f.listUsers(w, nsName, ns)
+		return
+	}
+	if action == "CreateUser" {
+		f.createUser(w, nsName, ns, params.Get("UserName"))
+		return
+	}
+	username := params.Get("UserName")
+	user, ok := ns.IamUsers[username]
+	if !ok {
+		writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The user with name %s cannot be found.", username))
+		return
+	}
+	switch action {
+	case "GetUser":
+		writeIamResult(w, action, map[string]any{"User": iamUserInfo(nsName, username, user)})
+	case "DeleteUser":
+		if len(user.AccessKeys) > 0 || len(user.AttachedPolicies) > 0 || len(user.InlinePolicies) > 0 {
+			writeIamError(w, http.StatusConflict, "DeleteConflict", "Cannot delete entity, must delete access keys and policies first.")
+			return
+		}
+		delete(ns.IamUsers, username)
+		writeIamResult(w, action, nil)
+	case "CreateAccessKey":
+		if len(user.AccessKeys) >= maxAccessKeys {
+			writeIamError(w, http.StatusConflict, "LimitExceeded", fmt.Sprintf("Cannot exceed quota for AccessKeysPerUser: %d", maxAccessKeys))
+			return
+		}
+		key := &AccessKey{Id: "AKIA" + randomString(upperDigits, 16), Secret: randomSecret(), Created: f.now()}
+		user.AccessKeys = append(user.AccessKeys, key)
+		info := accessKeyInfo(username, key)
+		info["SecretAccessKey"] = key.Secret
+		writeIamResult(w, action, map[string]any{"AccessKey": info})
+	case "ListAccessKeys":
+		keys := []map[string]any{}
+		for _, key := range user.AccessKeys {
+			keys = append(keys, accessKeyInfo(username, key))
+		}
+		writeIamResult(w, action, map[string]any{"AccessKeyMetadata": keys, "IsTruncated": false})
+	case "DeleteAccessKey":
+		id := params.Get("AccessKeyId")
+		i := slices.IndexFunc(user.AccessKeys, func(key *AccessKey) bool { return key.Id == id })
+		if i < 0 {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The Access Key with id %s cannot be found.", id))
+			return
+		}
+		user.AccessKeys = slices.Delete(user.AccessKeys, i, i+1)
+		writeIamResult(w, action, nil)
+	case "AttachUserPolicy":
+		policyArn := params.Get("PolicyArn")
+		if !slices.Contains(builtinPolicies, policyArn) && !slices.Contains(ns.Policies, policyArn) {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("Policy %s does not exist.", policyArn))
+			return
+		}
+		if !slices.Contains(user.AttachedPolicies, policyArn) {
+			user.AttachedPolicies = append(user.AttachedPolicies, policyArn)
+		}
+		writeIamResult(w, action, nil)
+	case "DetachUserPolicy":
+		policyArn := params.Get("PolicyArn")
+		i := slices.Index(user.AttachedPolicies, policyArn)
+		if i < 0 {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("Policy %s is not attached to user %s.", policyArn, username))
+			return
+		}
+		user.AttachedPolicies = slices.Delete(user.AttachedPolicies, i, i+1)
+		writeIamResult(w, action, nil)
+	case "ListAttachedUserPolicies":
+		policies := []map[string]string{}
+		for _, policyArn := range user.AttachedPolicies {
+			policies = append(policies, map[string]string{"PolicyArn": policyArn, "PolicyName": policyName(policyArn)})
+		}
+		writeIamResult(w, action, map[string]any{"AttachedPolicies": policies, "IsTruncated": false})
+	case "PutUserPolicy":
+		document := params.Get("PolicyDocument")
+		if !json.Valid([]byte(document)) {
+			writeIamError(w, http.StatusBadRequest, "MalformedPolicyDocument", "The policy document is not valid json.")
+			return
+		}
+		user.InlinePolicies[params.Get("PolicyName")] = document
+		writeIamResult(w, action, nil)
+	case "GetUserPolicy":
+		name := params.Get("PolicyName")
+		document, ok := user.InlinePolicies[name]
+		if !ok {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The user policy with name %s cannot be found.", name))
+			return
+		}
+		writeIamResult(w, action, map[string]string{
+			"UserName":       username,
+			"PolicyName":     name,
+			"PolicyDocument": url.QueryEscape(document),
+		})
+	case "DeleteUserPolicy":
+		name := params.Get("PolicyName")
+		if _, ok := user.InlinePolicies[name]; !ok {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The user policy with name %s cannot be found.", name))
+			return
+		}
+		delete(user.InlinePolicies, name)
+		writeIamResult(w, action, nil)
+	case "ListUserPolicies":
+		writeIamResult(w, action, map[string]any{"PolicyNames": sortedNames(user.InlinePolicies), "IsTruncated": false})
+	case "AddUserToGroup":
+		group := params.Get("GroupName")
+		if !slices.Contains(ns.Groups, group) {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("The group with name %s cannot be found.", group))
+			return
+		}
+		if !slices.Contains(user.Groups, group) {
+			user.Groups = append(user.Groups, group)
+		}
+		writeIamResult(w, action, nil)
+	case "RemoveUserFromGroup":
+		group := params.Get("GroupName")
+		i := slices.Index(user.Groups, group)
+		if i < 0 {
+			writeIamError(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("User %s is not in group %s.", username, group))
+			return
+		}
+		user.Groups = slices.Delete(user.Groups, i, i+1)
+		writeIamResult(w, action, nil)
+	case "ListGroupsForUser":
+		groups := []map[string]string{}
+		for _, group := range user.Groups {
+			groups = append(groups, map[string]string{"GroupName": group, "Arn": fmt.Sprintf("urn:ecs:iam::%s:group/%s", nsName, group)})
+		}
+		writeIamResult(w, action, map[string]any{"Groups": groups, "IsTruncated": false})
+	case "TagUser":
+		for i := 1; params.Has("Tags.member." + strconv.Itoa(i) + ".Key"); i++ {
+			prefix := "Tags.member." + strconv.Itoa(i)
+			user.Tags[params.Get(prefix+".Key")] = params.Get(prefix + ".Value")
+		}
+		if len(user.Tags) > maxUserTags {
+			writeIamError(w, http.StatusConflict, "LimitExceeded", fmt.Sprintf("Cannot exceed quota for TagsPerUser: %d", maxUserTags))
+			return
+		}
+		writeIamResult(w, action, nil)
+	case "UntagUser":
+		for i := 1; params.Has("TagKeys.member." + strconv.Itoa(i)); i++ {
+			delete(user.Tags, params.Get("TagKeys.member."+strconv.Itoa(i)))
+		}
+		writeIamResult(w, action, nil)
+	case "ListUserTags":
+		tags := []map[string]string{}
+		for _, key := range sortedNames(user.Tags) {
+			tags = append(tags, map[string]string{"Key": key, "Value": user.Tags[key]})
+		}
+		writeIamResult(w, action, map[string]any{"Tags": tags, "IsTruncated": false})
+	default:
+		writeIamError(w, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("Action %s is not supported.", action))
+	}
+}
+
+func (f *Fake) listUsers(w http.ResponseWriter, nsName string, ns *Namespace) {
+	users := []map[string]any{}
+	for _, username := range sortedNames(ns.IamUsers) {
+		users = append(users, iamUserInfo(nsName, username, ns.IamUsers[username]))
+	}
+	writeIamResult(w, "ListUsers", map[string]any{"Users": users, "IsTruncated": false})
+}
+
+func (f *Fake) createUser(w http.ResponseWriter, nsName string, ns *Namespace, username string) {
+	if !validIamName(username) {
+		writeIamError(w, http.StatusBadRequest, "ValidationError", fmt.Sprintf("Invalid user name %q.", username))
+		return
+	}
+	if _, ok := ns.IamUsers[username]; ok {
+		writeIamError(w, http.StatusConflict, "EntityAlreadyExists", fmt.Sprintf("User with name %s already exists.", username))
+		return
+	}
+	user := &IamUser{Created: f.now(), InlinePolicies: map[string]string{}, Tags: map[string]string{}}
+	ns.IamUsers[username] = user
+	writeIamResult(w, "CreateUser", map[string]any{"User": iamUserInfo(nsName, username, user)})
+}
+
+func iamUserInfo(nsName, username string, user *IamUser) map[string]any {
+	return map[string]any{
+		"UserName":   username,
+		"UserId":     username,
+		"Path":       "/",
+		"Arn":        fmt.Sprintf("urn:ecs:iam::%s:user/%s", nsName, username),
+		"CreateDate": user.Created.Format(iamDateLayout),
+	}
+}
+
+func accessKeyInfo(username string, key *AccessKey) map[string]any {
+	return map[string]any{
+		"AccessKeyId": key.Id,
+		"UserName":    username,
+		"Status":      "Active",
+		"CreateDate":  key.Created.Format(iamDateLayout),
+	}
+}
+
+func policyName(policyArn string) string {
+	for i := len(policyArn) - 1; i >= 0; i-- {
+		if policyArn[i] == '/' {
+			return policyArn[i+1:]
+		}
+	}
+	return policyArn
+}
+
+// validIamName follows the aws rules: 1 to 64 letters, digits or +=,.@_- characters
+func validIamName(name string) bool {
+	if len(name) == 0 || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '+' || c == '=' || c == ',' || c == '.' || c == '@' || c == '_' || c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package fakeecs
+
+import (
+	"fmt"
+	"golang.org/x/exp/slices"
+	"net/http"
+	"strings"
+)
+
+// namespaces serves /object/namespaces.json and /object/namespaces/namespace/...
+func (f *Fake) namespaces(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if path == "/object/namespaces.json" && r.Method == http.MethodGet {
+		namespaces := []map[string]string{}
+		for _, name := range sortedNames(f.state.Namespaces) {
+			namespaces = append(namespaces, map[string]string{"id": name, "name": name})
+		}
+		writeJSON(w, map[string]any{"namespace": namespaces})
+		return
+	}
+	if path == "/object/namespaces/namespace.json" && r.Method == http.MethodPost {
+		f.createNamespace(w, r)
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "/object/namespaces/namespace/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+		return
+	}
+	name, sub, _ := strings.Cut(strings.TrimSuffix(rest, ".json"), "/")
+	ns, ok := f.state.Namespaces[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Namespace %s not found", name))
+		return
+	}
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		writeJSON(w, namespaceInfo(name, ns))
+	case sub == "" && r.Method == http.MethodPut:
+		f.updateNamespace(w, r, ns)
+	case sub == "deactivate" && r.Method == http.MethodPost:
+		if len(ns.Buckets) > 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Namespace %s has buckets", name))
+			return
+		}
+		delete(f.state.Namespaces, name)
+		w.WriteHeader(http.StatusOK)
+	case sub == "quota" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]any{"namespace": name, "blockSize": ns.QuotaBlockSize, "notificationSize": ns.QuotaNotificationSize})
+	case sub == "quota" && r.Method == http.MethodPut:
+		var quota struct {
+			BlockSize        int64 `json:"blockSize"`
+			NotificationSize int64 `json:"notificationSize"`
+		}
+		if !readJSON(w, r, &quota) {
+			return
+		}
+		if quota.BlockSize > 0 && quota.NotificationSize > quota.BlockSize {
+			writeError(w, http.StatusBadRequest, "notificationSize must not exceed blockSize")
+			return
+		}
+		ns.QuotaBlockSize, ns.QuotaNotificationSize = quota.BlockSize, quota.NotificationSize
+		w.WriteHeader(http.StatusOK)
+	case sub == "quota" && r.Method == http.MethodDelete:
+		ns.QuotaBlockSize, ns.QuotaNotificationSize = -1, -1
+		w.WriteHeader(http.StatusOK)
+	case sub == "retention" && r.Method == http.MethodGet:
+		classes := []map[string]any{}
+		for _, className := range sortedNames(ns.RetentionClasses) {
+			classes = append(classes, map[string]any{"name": className, "period": ns.RetentionClasses[className]})
+		}
+		writeJSON(w, map[string]any{"retention_class": classes})
+	case sub == "retention" && r.Method == http.MethodPost:
+		var class struct {
+			Name   string `json:"name"`
+			Period int64  `json:"period"`
+		}
+		if !readJSON(w, r, &class) {
+			return
+		}
+		if _, ok := ns.RetentionClasses[class.Name]; ok || class.Name == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Retention class %q already exists or is invalid", class.Name))
+			return
+		}
+		ns.RetentionClasses[class.Name] = class.Period
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(sub, "retention/") && r.Method == http.MethodPut:
+		className := strings.TrimPrefix(sub, "retention/")
+		if _, ok := ns.RetentionClasses[className]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Retention class %s not found", className))
+			return
+		}
+		var class struct {
+			Period int64 `json:"period"`
+		}
+		if !readJSON(w, r, &class) {
+			return
+		}
+		ns.RetentionClasses[className] = class.Period
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+	}
+}
+
+func (f *Fake) createNamespace(w http.ResponseWriter, r *http.Request) {
+	var create struct {
+		Namespace              string `json:"namespace"`
+		DefaultVpool           string `json:"default_data_services_vpool"`
+		Admins                 string `json:"namespace_admins"`
+		DefaultBucketBlockSize int64  `json:"default_bucket_block_size"`
+	}
+	if !readJSON(w, r, &create) {
+		return
+	}
+	if create.Namespace == "" {
+		writeError(w, http.StatusBadRequest, "namespace is required")
+		return
+	}
+	if _, ok := f.state.Namespaces[create.Namespace]; ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Namespace %s already exists", create.Namespace))
+		return
+	}
+	if create.DefaultVpool == "" && len(f.state.ReplicationGroups) > 0 {
+		create.DefaultVpool = f.state.ReplicationGroups[0]
+	}
+	if !slices.Contains(f.state.ReplicationGroups, create.DefaultVpool) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Replication group %s not found", create.DefaultVpool))
+		return
+	}
+	ns := newNamespace(create.DefaultVpool)
+	ns.Admins = create.Admins
+	if create.DefaultBucketBlockSize > 0 {
+		ns.DefaultBucketBlockSize = create.DefaultBucketBlockSize
+	}
+	f.state.Namespaces[create.Namespace] = ns
+	f.state.init()
+	writeJSON(w, map[string]string{"id": create.Namespace, "name": create.Namespace})
+}
+
+func (f *Fake) updateNamespace(w http.ResponseWriter, r *http.Request, ns *Namespace) {
+	var update struct {
+		DefaultVpool           string `json:"default_data_services_vpool"`
+		Admins                 string `json:"namespace_admins"`
+		DefaultBucketBlockSize int64  `json:"default_bucket_block_size"`
+	}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	if update.DefaultVpool != "" {
+		if !slices.Contains(f.state.ReplicationGroups, update.DefaultVpool) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Replication group %s not found", update.DefaultVpool))
+			return
+		}
+		ns.DefaultVpool = update.DefaultVpool
+	}
+	ns.Admins = update.Admins
+	ns.DefaultBucketBlockSize = update.DefaultBucketBlockSize
+	if ns.DefaultBucketBlockSize == 0 {
+		ns.DefaultBucketBlockSize = -1
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func namespaceInfo(name string, ns *Namespace) map[string]any {
+	return map[string]any{
+		"id":                          name,
+		"name":                        name,
+		"default_data_services_vpool": ns.DefaultVpool,
+		"namespace_admins":            ns.Admins,
+		"default_bucket_block_size":   ns.DefaultBucketBlockSize,
+		"inactive":                    false,
+	}
+}
@@ -0,0 +1,213 @@
+package fakeecs
+
+import (
+	"fmt"
+	"golang.org/x/exp/slices"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// objectUsers serves /object/users, /object/user-secret-keys and /object/user-password
+func (f *Fake) objectUsers(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/object/users.json" && r.Method == http.MethodPost:
+		f.createObjectUser(w, r)
+	case path == "/object/users/lock.json" && r.Method == http.MethodPut:
+		var lock struct {
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+			IsLocked  bool   `json:"isLocked"`
+		}
+		if !readJSON(w, r, &lock) {
+			return
+		}
+		if user := f.objectUser(w, lock.Namespace, lock.User); user != nil {
+			user.Locked = lock.IsLocked
+			w.WriteHeader(http.StatusOK)
+		}
+	case path == "/object/users/deactivate.json" && r.Method == http.MethodPost:
+		var deactivate struct {
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		}
+		if !readJSON(w, r, &deactivate) {
+			return
+		}
+		if user := f.objectUser(w, deactivate.Namespace, deactivate.User); user != nil {
+			delete(f.state.Namespaces[deactivate.Namespace].ObjectUsers, deactivate.User)
+			w.WriteHeader(http.StatusOK)
+		}
+	case strings.HasPrefix(path, "/object/users/") && strings.HasSuffix(path, "/info.json") && r.Method == http.MethodGet:
+		username := strings.TrimSuffix(strings.TrimPrefix(path, "/object/users/"), "/info.json")
+		nsName := r.URL.Query().Get("namespace")
+		if user := f.objectUser(w, nsName, username); user != nil {
+			writeJSON(w, map[string]any{
+				"name":      username,
+				"namespace": nsName,
+				"locked":    user.Locked,
+				"created":   user.Created.Format(time.RFC3339),
+			})
+		}
+	case strings.HasPrefix(path, "/object/user-secret-keys/"):
+		f.secretKeys(w, r, strings.TrimPrefix(path, "/object/user-secret-keys/"))
+	case strings.HasPrefix(path, "/object/user-password/"):
+		f.swiftPassword(w, r, strings.TrimPrefix(path, "/object/user-password/"))
+	default:
+		writeError(w, http.StatusNotFound, "Unknown resource "+path)
+	}
+}
+
+func (f *Fake) createObjectUser(w http.ResponseWriter, r *http.Request) {
+	var create struct {
+		User      string `json:"user"`
+		Namespace string `json:"namespace"`
+	}
+	if !readJSON(w, r, &create) {
+		return
+	}
+	ns, ok := f.state.Namespaces[create.Namespace]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Namespace %s not found", create.Namespace))
+		return
+	}
+	if create.User == "" {
+		writeError(w, http.StatusBadRequest, "user is required")
+		return
+	}
+	if _, ok := ns.ObjectUsers[create.User]; ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Object user %s already exists", create.User))
+		return
+	}
+	ns.ObjectUsers[create.User] = &ObjectUser{Created: f.now()}
+	writeJSON(w, map[string]string{"id": create.User})
+}
+
+// objectUser writes a 404 and returns nil when the user does not exist
+func (f *Fake) objectUser(w http.ResponseWriter, nsName, username string) *ObjectUser {
+	if ns, ok := f.state.Namespaces[nsName]; ok {
+		if user, ok := ns.ObjectUsers[username]; ok {
+			return user
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("Object user %s not found in namespace %s", username, nsName))
+	return nil
+}
+
+func (f *Fake) secretKeys(w http.ResponseWriter, r *http.Request, rest string) {
+	switch {
+	case strings.HasSuffix(rest, "/deactivate.json") && r.Method == http.MethodPost:
+		var deactivate struct {
+			Namespace string `json:"namespace"`
+			SecretKey string `json:"secret_key"`
+		}
+		if !readJSON(w, r, &deactivate) {
+			return
+		}
+		user := f.objectUser(w, deactivate.Namespace, strings.TrimSuffix(rest, "/deactivate.json"))
+		if user == nil {
+			return
+		}
+		keys := user.validSecretKeys(f.now())
+		i := slices.IndexFunc(keys, func(key *SecretKey) bool { return key.Secret == deactivate.SecretKey })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "Secret key not found")
+			return
+		}
+		user.SecretKeys = slices.Delete(keys, i, i+1)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet:
+		user := f.objectUser(w, r.URL.Query().Get("namespace"), strings.TrimSuffix(rest, ".json"))
+		if user == nil {
+			return
+		}
+		response := map[string]string{}
+		for i, key := range user.validSecretKeys(f.now()) {
+			n := fmt.Sprint(i + 1)
+			response["secret_key_"+n] = key.Secret
+			response["key_timestamp_"+n] = key.Created.Format(ecsTimestampLayout)
+			response["key_expiry_timestamp_"+n] = ecsExpiry(key)
+		}
+		writeJSON(w, response)
+	case r.Method == http.MethodPost:
+		var create struct {
+			Namespace                 string `json:"namespace"`
+			ExistingKeyExpiryTimeMins int    `json:"existing_key_expiry_time_mins"`
+		}
+		if !readJSON(w, r, &create) {
+			return
+		}
+		user := f.objectUser(w, create.Namespace, strings.TrimSuffix(rest, ".json"))
+		if user == nil {
+			return
+		}
+		now := f.now()
+		keys := user.validSecretKeys(now)
+		if len(keys) >= maxSecretKeys {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Object user already has %d valid secret keys", maxSecretKeys))
+			return
+		}
+		if create.ExistingKeyExpiryTimeMins > 0 {
+			for _, key := range keys {
+				key.Expiry = now.Add(time.Duration(create.ExistingKeyExpiryTimeMins) * time.Minute)
+			}
+		}
+		key := &SecretKey{Secret: randomSecret(), Created: now}
+		user.SecretKeys = append(keys, key)
+		writeJSON(w, map[string]string{
+			"secret_key":           key.Secret,
+			"key_timestamp":        key.Created.Format(ecsTimestampLayout),
+			"key_expiry_timestamp": "",
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	}
+}
+
+func (f *Fake) swiftPassword(w http.ResponseWriter, r *http.Request, rest string) {
+	var password struct {
+		Namespace string   `json:"namespace"`
+		Password  string   `json:"password"`
+		Groups    []string `json:"groups_list"`
+	}
+	switch {
+	case strings.HasSuffix(rest, "/deactivate.json") && r.Method == http.MethodPost:
+		if !readJSON(w, r, &password) {
+			return
+		}
+		user := f.objectUser(w, password.Namespace, strings.TrimSuffix(rest, "/deactivate.json"))
+		if user == nil {
+			return
+		}
+		if user.SwiftPassword == "" {
+			writeError(w, http.StatusNotFound, "Object user has no swift password")
+			return
+		}
+		user.SwiftPassword, user.SwiftGroups = "", nil
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut:
+		if !readJSON(w, r, &password) {
+			return
+		}
+		user := f.objectUser(w, password.Namespace, strings.TrimSuffix(rest, ".json"))
+		if user == nil {
+			return
+		}
+		if password.Password == "" {
+			writeError(w, http.StatusBadRequest, "password is required")
+			return
+		}
+		user.SwiftPassword, user.SwiftGroups = password.Password, password.Groups
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	}
+}
+
+func ecsExpiry(key *SecretKey) string {
+	if key.Expiry.IsZero() {
+		return ""
+	}
+	return key.Expiry.Format(ecsTimestampLayout)
+}
@@ -0,0 +1,225 @@
+package fakeecs
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultUsername and DefaultPassword log in to the default state as system admin
+	DefaultUsername = "root"
+	DefaultPassword = "ChangeMe1!"
+	// DefaultNamespace and DefaultReplicationGroup exist in the default state
+	DefaultNamespace        = "ns1"
+	DefaultReplicationGroup = "rg1"
+)
+
+// builtinPolicies are the managed policies every ECS namespace has
+var builtinPolicies = []string{
+	"urn:ecs:iam:::policy/ECSS3FullAccess",
+	"urn:ecs:iam:::policy/ECSS3ReadOnlyAccess",
+	"urn:ecs:iam:::policy/IAMFullAccess",
+	"urn:ecs:iam:::policy/IAMReadOnlyAccess",
+}
+
+// State is the whole content of the fake, it marshals to json so it can be saved and loaded
+type State struct {
+	ManagementUsers   map[string]*ManagementUser `json:"management_users"`
+	ReplicationGroups []string                   `json:"replication_groups"`
+	Namespaces        map[string]*Namespace      `json:"namespaces"`
+}
+
+type ManagementUser struct {
+	Password        string `json:"password"`
+	IsSystemAdmin   bool   `json:"is_system_admin"`
+	IsSystemMonitor bool   `json:"is_system_monitor"`
+	IsSecurityAdmin bool   `json:"is_security_admin"`
+}
+
+type Namespace struct {
+	DefaultVpool           string           `json:"default_vpool"`
+	Admins                 string           `json:"admins,omitempty"`
+	DefaultBucketBlockSize int64            `json:"default_bucket_block_size"`
+	QuotaBlockSize         int64            `json:"quota_block_size"`
+	QuotaNotificationSize  int64            `json:"quota_notification_size"`
+	RetentionClasses       map[string]int64 `json:"retention_classes,omitempty"`
+	// Groups, Policies and Roles are the iam entities users can be added to, attached or assume
+	Groups      []string               `json:"groups,omitempty"`
+	Policies    []string               `json:"policies,omitempty"`
+	Roles       []string               `json:"roles,omitempty"`
+	IamUsers    map[string]*IamUser    `json:"iam_users,omitempty"`
+	ObjectUsers map[string]*ObjectUser `json:"object_users,omitempty"`
+	Buckets     map[string]*Bucket     `json:"buckets,omitempty"`
+}
+
+type IamUser struct {
+	Created          time.Time         `json:"created"`
+	AccessKeys       []*AccessKey      `json:"access_keys,omitempty"`
+	AttachedPolicies []string          `json:"attached_policies,omitempty"`
+	InlinePolicies   map[string]string `json:"inline_policies,omitempty"`
+	Groups           []string          `json:"groups,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+type AccessKey struct {
+	Id      string    `json:"id"`
+	Secret  string    `json:"secret"`
+	Created time.Time `json:"created"`
+}
+
+type ObjectUser struct {
+	Created       time.Time    `json:"created"`
+	Locked        bool         `json:"locked"`
+	SecretKeys    []*SecretKey `json:"secret_keys,omitempty"`
+	SwiftPassword string       `json:"swift_password,omitempty"`
+	SwiftGroups   []string     `json:"swift_groups,omitempty"`
+}
+
+type SecretKey struct {
+	Secret  string    `json:"secret"`
+	Created time.Time `json:"created"`
+	// Expiry is zero for keys that do not expire
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+// Bucket quotas are in GB, -1 when not set
+type Bucket struct {
+	Owner            string    `json:"owner,omitempty"`
+	Vpool            string    `json:"vpool"`
+	Created          time.Time `json:"created"`
+	BlockSize        int64     `json:"block_size"`
+	NotificationSize int64     `json:"notification_size"`
+	Retention        int64     `json:"retention"`
+	Policy           string    `json:"policy,omitempty"`
+	Versioning       string    `json:"versioning,omitempty"`
+}
+
+// NewState returns a cluster with a system admin, a replication group and an empty namespace
+func NewState() *State {
+	return &State{
+		ManagementUsers: map[string]*ManagementUser{
+			DefaultUsername: {Password: DefaultPassword, IsSystemAdmin: true},
+		},
+		ReplicationGroups: []string{DefaultReplicationGroup},
+		Namespaces: map[string]*Namespace{
+			DefaultNamespace: newNamespace(DefaultReplicationGroup),
+		},
+	}
+}
+
+// LoadState reads a state saved by SaveState
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	state.init()
+	return &state, nil
+}
+
+// SaveState writes the current state of the fake as json, through a temporary file so a crash never leaves half a state
+func (f *Fake) SaveState(path string) error {
+	f.lock.Lock()
+	data, err := json.MarshalIndent(f.state, "", "  ")
+	f.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newNamespace(vpool string) *Namespace {
+	return &Namespace{
+		DefaultVpool:           vpool,
+		DefaultBucketBlockSize: -1,
+		QuotaBlockSize:         -1,
+		QuotaNotificationSize:  -1,
+	}
+}
+
+// init creates the maps missing from a state built by hand or loaded from json
+func (s *State) init() {
+	if s.ManagementUsers == nil {
+		s.ManagementUsers = map[string]*ManagementUser{}
+	}
+	if s.Namespaces == nil {
+		s.Namespaces = map[string]*Namespace{}
+	}
+	for _, ns := range s.Namespaces {
+		if ns.RetentionClasses == nil {
+			ns.RetentionClasses = map[string]int64{}
+		}
+		if ns.IamUsers == nil {
+			ns.IamUsers = map[string]*IamUser{}
+		}
+		if ns.ObjectUsers == nil {
+			ns.ObjectUsers = map[string]*ObjectUser{}
+		}
+		if ns.Buckets == nil {
+			ns.Buckets = map[string]*Bucket{}
+		}
+		for _, user := range ns.IamUsers {
+			if user.InlinePolicies == nil {
+				user.InlinePolicies = map[string]string{}
+			}
+			if user.Tags == nil {
+				user.Tags = map[string]string{}
+			}
+		}
+	}
+}
+
+// bucket looks a bucket up across namespaces, bucket names are unique in the cluster
+func (s *State) bucket(name string) (string, *Bucket) {
+	for nsName, ns := range s.Namespaces {
+		if bucket, ok := ns.Buckets[name]; ok {
+			return nsName, bucket
+		}
+	}
+	return "", nil
+}
+
+// accessKey looks up the iam user owning the access key id
+func (s *State) accessKey(id string) (string, string, *AccessKey) {
+	for nsName, ns := range s.Namespaces {
+		for username, user := range ns.IamUsers {
+			for _, key := range user.AccessKeys {
+				if key.Id == id {
+					return nsName, username, key
+				}
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// validSecretKeys drops the expired keys of the object user and returns the others
+func (u *ObjectUser) validSecretKeys(now time.Time) []*SecretKey {
+	var keys []*SecretKey
+	for _, key := range u.SecretKeys {
+		if key.Expiry.IsZero() || key.Expiry.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	u.SecretKeys = keys
+	return keys
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,129 @@
+package fakeecs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minStsDuration = 15 * time.Minute
+	maxStsDuration = 12 * time.Hour
+)
+
+type assumeRoleResponse struct {
+	XMLName xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse"`
+	Result  struct {
+		Credentials struct {
+			AccessKeyId     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+			Expiration      string `xml:"Expiration"`
+		} `xml:"Credentials"`
+		AssumedRoleUser struct {
+			Arn           string `xml:"Arn"`
+			AssumedRoleId string `xml:"AssumedRoleId"`
+		} `xml:"AssumedRoleUser"`
+	} `xml:"AssumeRoleResult"`
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(s3Error{Code: code, Message: message})
+}
+
+// sts serves the AssumeRole action, the caller is the iam user owning the signing access key
+func (f *Fake) sts(w http.ResponseWriter, r *http.Request) {
+	nsName, _, key := f.state.accessKey(signingKeyId(r))
+	if key == nil {
+		writeS3Error(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid.")
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "AssumeRole" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidAction", "Only AssumeRole is supported.")
+		return
+	}
+	roleArn := r.PostForm.Get("RoleArn")
+	roleName, found := strings.CutPrefix(roleArn, fmt.Sprintf("urn:ecs:iam::%s:role/", nsName))
+	if !found || !slices.Contains(f.state.Namespaces[nsName].Roles, roleName) {
+		writeS3Error(w, http.StatusNotFound, "NoSuchEntity", fmt.Sprintf("Role %s cannot be found.", roleArn))
+		return
+	}
+	duration := time.Hour
+	if seconds := r.PostForm.Get("DurationSeconds"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		duration = time.Duration(n) * time.Second
+		if err != nil || duration < minStsDuration || duration > maxStsDuration {
+			writeS3Error(w, http.StatusBadRequest, "ValidationError", "DurationSeconds is out of range.")
+			return
+		}
+	}
+	sessionName := r.PostForm.Get("RoleSessionName")
+	var response assumeRoleResponse
+	response.Result.Credentials.AccessKeyId = "ASIA" + randomString(upperDigits, 16)
+	response.Result.Credentials.SecretAccessKey = randomSecret()
+	response.Result.Credentials.SessionToken = randomString(alphanumeric, 64)
+	response.Result.Credentials.Expiration = f.now().Add(duration).Format(time.RFC3339)
+	response.Result.AssumedRoleUser.Arn = fmt.Sprintf("urn:ecs:sts::%s:assumed-role/%s/%s", nsName, roleName, sessionName)
+	response.Result.AssumedRoleUser.AssumedRoleId = randomString(upperDigits, 16) + ":" + sessionName
+	writeXML(w, response)
+}
+
+// s3 serves the bucket versioning configuration, the only s3 call of the plugin
+func (f *Fake) s3(w http.ResponseWriter, r *http.Request) {
+	nsName, _, key := f.state.accessKey(signingKeyId(r))
+	if key == nil {
+		writeS3Error(w, http.StatusForbidden, "InvalidAccessKeyId", "The access key id does not exist.")
+		return
+	}
+	name := strings.Trim(r.URL.Path, "/")
+	if r.Method != http.MethodPut || !r.URL.Query().Has("versioning") || strings.Contains(name, "/") {
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "Only PUT bucket versioning is supported.")
+		return
+	}
+	bucketNs, bucket := f.state.bucket(name)
+	if bucket == nil {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", fmt.Sprintf("Bucket %s does not exist.", name))
+		return
+	}
+	if bucketNs != nsName {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	var config struct {
+		Status string `xml:"Status"`
+	}
+	if err := xml.Unmarshal(body, &config); err != nil || (config.Status != "Enabled" && config.Status != "Suspended") {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", "The versioning configuration is not valid.")
+		return
+	}
+	bucket.Versioning = config.Status
+	w.WriteHeader(http.StatusOK)
+}
+
+// signingKeyId reads the access key id from the sigv4 Authorization header
+func signingKeyId(r *http.Request) string {
+	_, credential, found := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	if !found {
+		return ""
+	}
+	id, _, _ := strings.Cut(credential, "/")
+	return id
+}
@@ -0,0 +1,11 @@
+package model
+
+// ManagedBucket records what vault set on a bucket that is not kept by the ECS management api
+type ManagedBucket struct {
+	Name       string `json:"-"`
+	Namespace  string `json:"namespace"`
+	Connection string `json:"connection,omitempty"`
+	// Role is the vault role whose iam user is granted access to the bucket
+	Role       string `json:"role,omitempty"`
+	Versioning bool   `json:"versioning"`
+}
@@ -1,8 +1,141 @@
 package model
 
+import (
+	"golang.org/x/exp/slices"
+	"strings"
+	"time"
+)
+
+const (
+	// ProviderEcs is the Dell ECS management api, the default provider
+	ProviderEcs = "ecs"
+	// ProviderCephRgw is the Ceph RADOS gateway admin ops api, its tenants are the namespaces
+	ProviderCephRgw = "ceph_rgw"
+
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultRequestTimeout = time.Minute
+
+	DefaultMaxRetries       = 3
+	DefaultMaxRetryBackoff  = 5 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
 type PluginConfig struct {
+	// Provider is the type of object store, ECS when empty
+	Provider string `json:"provider,omitempty"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Url      string `json:"url"`
-	SkipSsl  bool   `json:"skip_ssl"`
+	// Urls are the other ECS nodes the client fails over to
+	Urls    []string `json:"urls,omitempty"`
+	SkipSsl bool     `json:"skip_ssl"`
+	// S3Url is the ECS s3 data endpoint, used for the bucket settings the management API does not cover
+	S3Url string `json:"s3_url,omitempty"`
+	// ConnectTimeout bounds the connection and TLS handshake to a node
+	ConnectTimeout time.Duration `json:"connect_timeout,omitempty"`
+	// RequestTimeout bounds each request, from connecting to reading the whole response
+	RequestTimeout time.Duration `json:"request_timeout,omitempty"`
+	// MaxRetries is the number of retries of idempotent calls failing transiently, -1 disables retries
+	// so that configs stored before retries existed get the default
+	MaxRetries int `json:"max_retries,omitempty"`
+	// MaxRetryBackoff caps the exponential wait between two retries
+	MaxRetryBackoff time.Duration `json:"max_retry_backoff,omitempty"`
+	// BreakerThreshold is the number of consecutive transient failures opening the circuit breaker, -1 disables it
+	BreakerThreshold int `json:"breaker_threshold,omitempty"`
+	// BreakerCooldown is how long calls fail fast once the circuit breaker is open
+	BreakerCooldown time.Duration `json:"breaker_cooldown,omitempty"`
+	// PasswordRotationPeriod is the period after which the management password is rotated automatically
+	PasswordRotationPeriod time.Duration `json:"password_rotation_period,omitempty"`
+	// LastRotated is the last time the management password was set, by an operator or by a rotation
+	LastRotated time.Time `json:"last_rotated,omitempty"`
+	// PasswordPolicy is the name of a vault password policy used to generate rotated passwords,
+	// when empty the explicit password parameters below are used
+	PasswordPolicy     string `json:"password_policy,omitempty"`
+	PasswordLength     int    `json:"password_length,omitempty"`
+	PasswordNumDigits  int    `json:"password_num_digits,omitempty"`
+	PasswordNumSymbols int    `json:"password_num_symbols,omitempty"`
+	PasswordSymbols    string `json:"password_symbols,omitempty"`
+	// PendingPassword is stored before a rotation changes the password on ECS, and promoted once a login with it succeeds
+	PendingPassword string `json:"pending_password,omitempty"`
+}
+
+// GetProvider defaults to ECS for configs stored before other providers were supported
+func (c *PluginConfig) GetProvider() string {
+	if c.Provider == "" {
+		return ProviderEcs
+	}
+	return c.Provider
+}
+
+// GetConnectTimeout defaults for configs stored before timeouts were configurable
+func (c *PluginConfig) GetConnectTimeout() time.Duration {
+	if c.ConnectTimeout <= 0 {
+		return DefaultConnectTimeout
+	}
+	return c.ConnectTimeout
+}
+
+// GetRequestTimeout defaults for configs stored before timeouts were configurable
+func (c *PluginConfig) GetRequestTimeout() time.Duration {
+	if c.RequestTimeout <= 0 {
+		return DefaultRequestTimeout
+	}
+	return c.RequestTimeout
+}
+
+// GetMaxRetries defaults when not set and is 0 when retries are disabled
+func (c *PluginConfig) GetMaxRetries() int {
+	if c.MaxRetries < 0 {
+		return 0
+	}
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+func (c *PluginConfig) GetMaxRetryBackoff() time.Duration {
+	if c.MaxRetryBackoff <= 0 {
+		return DefaultMaxRetryBackoff
+	}
+	return c.MaxRetryBackoff
+}
+
+// GetBreakerThreshold defaults when not set and is 0 when the circuit breaker is disabled
+func (c *PluginConfig) GetBreakerThreshold() int {
+	if c.BreakerThreshold < 0 {
+		return 0
+	}
+	if c.BreakerThreshold == 0 {
+		return DefaultBreakerThreshold
+	}
+	return c.BreakerThreshold
+}
+
+func (c *PluginConfig) GetBreakerCooldown() time.Duration {
+	if c.BreakerCooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return c.BreakerCooldown
+}
+
+// NextRotation is zero when scheduled password rotation is disabled
+func (c *PluginConfig) NextRotation() time.Time {
+	if c.PasswordRotationPeriod <= 0 {
+		return time.Time{}
+	}
+	return c.LastRotated.Add(c.PasswordRotationPeriod)
+}
+
+// Endpoints lists the ECS node urls, url first, without duplicates
+func (c *PluginConfig) Endpoints() []string {
+	var endpoints []string
+	for _, url := range append([]string{c.Url}, c.Urls...) {
+		url = strings.TrimSuffix(url, "/")
+		if url != "" && !slices.Contains(endpoints, url) {
+			endpoints = append(endpoints, url)
+		}
+	}
+	return endpoints
 }
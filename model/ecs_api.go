@@ -1,11 +1,53 @@
 package model
 
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+)
+
 type Namespaces struct {
 	Namespace []Namespace `json:"namespace"`
 }
 
 type Namespace struct {
 	Name string `json:"name"`
+	// DefaultVpool is the default replication group of the namespace buckets
+	DefaultVpool string `json:"default_data_services_vpool,omitempty"`
+	// Admins is a comma separated list of management users
+	Admins string `json:"namespace_admins,omitempty"`
+	// DefaultBucketBlockSize is the hard quota in GB of new buckets, -1 when not set
+	DefaultBucketBlockSize int64 `json:"default_bucket_block_size,omitempty"`
+}
+
+type NamespaceCreate struct {
+	Namespace              string `json:"namespace"`
+	DefaultVpool           string `json:"default_data_services_vpool,omitempty"`
+	Admins                 string `json:"namespace_admins,omitempty"`
+	DefaultBucketBlockSize int64  `json:"default_bucket_block_size,omitempty"`
+}
+
+type NamespaceUpdate struct {
+	DefaultVpool           string `json:"default_data_services_vpool,omitempty"`
+	Admins                 string `json:"namespace_admins"`
+	DefaultBucketBlockSize int64  `json:"default_bucket_block_size"`
+}
+
+// NamespaceQuota sizes are in GB, -1 when not set
+type NamespaceQuota struct {
+	Namespace        string `json:"namespace,omitempty"`
+	BlockSize        int64  `json:"blockSize"`
+	NotificationSize int64  `json:"notificationSize"`
+}
+
+type RetentionClasses struct {
+	RetentionClass []RetentionClass `json:"retention_class"`
+}
+
+// RetentionClass period is in seconds
+type RetentionClass struct {
+	Name   string `json:"name,omitempty"`
+	Period int64  `json:"period"`
 }
 
 type ListIamUsers struct {
@@ -21,10 +63,27 @@ type IamUser struct {
 }
 
 type VdcUser struct {
-	Password        string `json:"password"`
-	IsSystemAdmin   string `json:"isSystemAdmin"`
-	IsSystemMonitor string `json:"isSystemMonitor"`
-	IsSecurityAdmin string `json:"isSecurityAdmin"`
+	Password        string     `json:"password,omitempty"`
+	IsSystemAdmin   BoolString `json:"isSystemAdmin"`
+	IsSystemMonitor BoolString `json:"isSystemMonitor"`
+	IsSecurityAdmin BoolString `json:"isSecurityAdmin"`
+}
+
+// BoolString is sent to ECS as "true" or "false" but may be returned as a json boolean
+type BoolString string
+
+func (b *BoolString) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = BoolString(strconv.FormatBool(value))
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*b = BoolString(str)
+	return nil
 }
 
 type AccessKey struct {
@@ -32,6 +91,12 @@ type AccessKey struct {
 	UserName        string `json:"UserName"`
 	SecretAccessKey string `json:"SecretAccessKey,omitempty"`
 	CreateDate      string `json:"CreateDate"`
+	// Imported is set by the plugin on keys adopted from an existing iam user rather than created by vault
+	Imported bool `json:"Imported,omitempty"`
+	// ExpiryDate is set on object user keys that are kept for a grace window after a rotation
+	ExpiryDate string `json:"ExpiryDate,omitempty"`
+	// Leases counts the outstanding leases handing out the key, the last one to be revoked retires it
+	Leases int `json:"Leases,omitempty"`
 }
 
 type CreateAccessKey struct {
@@ -49,3 +114,174 @@ type ListAccessKeys struct {
 type AccessKeyMetadata struct {
 	AccessKeys []AccessKey `json:"AccessKeyMetadata"`
 }
+
+type ListAttachedUserPolicies struct {
+	ListAttachedUserPoliciesResult AttachedPolicies `json:"ListAttachedUserPoliciesResult"`
+}
+
+type AttachedPolicies struct {
+	AttachedPolicies []AttachedPolicy `json:"AttachedPolicies"`
+}
+
+type AttachedPolicy struct {
+	PolicyArn  string `json:"PolicyArn"`
+	PolicyName string `json:"PolicyName"`
+}
+
+type GetUserPolicy struct {
+	GetUserPolicyResult UserPolicy `json:"GetUserPolicyResult"`
+}
+
+type UserPolicy struct {
+	PolicyName     string `json:"PolicyName"`
+	PolicyDocument string `json:"PolicyDocument"`
+	UserName       string `json:"UserName"`
+}
+
+type ListGroupsForUser struct {
+	ListGroupsForUserResult IamGroups `json:"ListGroupsForUserResult"`
+}
+
+type IamGroups struct {
+	Groups []IamGroup `json:"Groups"`
+}
+
+type IamGroup struct {
+	GroupName string `json:"GroupName"`
+}
+
+type ListUserTags struct {
+	ListUserTagsResult UserTags `json:"ListUserTagsResult"`
+}
+
+type UserTags struct {
+	Tags []Tag `json:"Tags"`
+}
+
+type Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// AssumeRoleResponse is returned as xml by the STS api
+type AssumeRoleResponse struct {
+	XMLName          xml.Name         `xml:"AssumeRoleResponse"`
+	AssumeRoleResult AssumeRoleResult `xml:"AssumeRoleResult"`
+}
+
+type AssumeRoleResult struct {
+	Credentials     StsCredentials  `xml:"Credentials"`
+	AssumedRoleUser AssumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+type StsCredentials struct {
+	AccessKeyId     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+type AssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleId string `xml:"AssumedRoleId"`
+}
+
+type BucketCreate struct {
+	Name              string `json:"name"`
+	Namespace         string `json:"namespace"`
+	Vpool             string `json:"vpool,omitempty"`
+	Owner             string `json:"owner,omitempty"`
+	HeadType          string `json:"head_type"`
+	FilesystemEnabled bool   `json:"filesystem_enabled"`
+	// Retention is the default retention period in seconds
+	Retention int64 `json:"retention,omitempty"`
+}
+
+type Buckets struct {
+	Bucket []Bucket `json:"object_bucket"`
+}
+
+// Bucket quotas are -1 when not set
+type Bucket struct {
+	Name             string `json:"name"`
+	Namespace        string `json:"namespace"`
+	Vpool            string `json:"vpool"`
+	Owner            string `json:"owner"`
+	BlockSize        int64  `json:"block_size"`
+	NotificationSize int64  `json:"notification_size"`
+	Retention        int64  `json:"retention"`
+	Created          string `json:"created"`
+}
+
+// BucketQuota sizes are in GB, -1 leaves the quota unset
+type BucketQuota struct {
+	Namespace        string `json:"namespace"`
+	BlockSize        int64  `json:"blockSize"`
+	NotificationSize int64  `json:"notificationSize"`
+}
+
+type BucketRetention struct {
+	Namespace string `json:"namespace"`
+	Period    int64  `json:"period"`
+}
+
+type BucketOwner struct {
+	Namespace string `json:"namespace"`
+	NewOwner  string `json:"new_owner"`
+}
+
+// BucketPolicy keeps statements as raw maps so the ones vault does not manage are written back untouched
+type BucketPolicy struct {
+	Version   string           `json:"Version"`
+	Id        string           `json:"Id,omitempty"`
+	Statement []map[string]any `json:"Statement"`
+}
+
+// VersioningConfiguration is the s3 api bucket versioning document
+type VersioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+type ObjectUser struct {
+	User      string `json:"user"`
+	Namespace string `json:"namespace"`
+}
+
+type ObjectUserLock struct {
+	User      string `json:"user"`
+	Namespace string `json:"namespace"`
+	IsLocked  bool   `json:"isLocked"`
+}
+
+type SecretKeyCreate struct {
+	Namespace                 string `json:"namespace"`
+	ExistingKeyExpiryTimeMins int    `json:"existing_key_expiry_time_mins"`
+}
+
+type SecretKeyDeactivate struct {
+	Namespace string `json:"namespace"`
+	SecretKey string `json:"secret_key"`
+}
+
+type SecretKeyCreated struct {
+	SecretKey          string `json:"secret_key"`
+	KeyTimestamp       string `json:"key_timestamp"`
+	KeyExpiryTimestamp string `json:"key_expiry_timestamp"`
+}
+
+// ObjectUserSecretKeys holds the up to two secret keys of an object user, unset ones are empty
+type ObjectUserSecretKeys struct {
+	SecretKey1          string `json:"secret_key_1"`
+	KeyTimestamp1       string `json:"key_timestamp_1"`
+	KeyExpiryTimestamp1 string `json:"key_expiry_timestamp_1"`
+	SecretKey2          string `json:"secret_key_2"`
+	KeyTimestamp2       string `json:"key_timestamp_2"`
+	KeyExpiryTimestamp2 string `json:"key_expiry_timestamp_2"`
+}
+
+type UserPassword struct {
+	Namespace string   `json:"namespace"`
+	Password  string   `json:"password,omitempty"`
+	Groups    []string `json:"groups_list,omitempty"`
+}
@@ -1,16 +1,69 @@
 package model
 
 import (
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"strings"
 	"time"
 )
 
+const (
+	// CredentialTypeStaticKeys roles hand out the two access keys of a single long-lived iam user
+	CredentialTypeStaticKeys = "static_keys"
+	// CredentialTypeDynamicUser roles create a new iam user for every lease
+	CredentialTypeDynamicUser = "dynamic_user"
+	// CredentialTypeAssumedRole roles hand out temporary STS credentials of an iam role, assumed with the role iam user keys
+	CredentialTypeAssumedRole = "assumed_role"
+
+	// UserTypeIamUser roles hand out the access keys of iam users
+	UserTypeIamUser = "iam_user"
+	// UserTypeObjectUser roles hand out the secret keys of legacy ECS object users
+	UserTypeObjectUser = "object_user"
+
+	// AuthTypeS3 object user roles hand out s3 secret keys
+	AuthTypeS3 = "s3"
+	// AuthTypeSwift object user roles hand out a swift password
+	AuthTypeSwift = "swift"
+
+	// DefaultConnection is the name of the ECS connection configured at config
+	DefaultConnection = "default"
+
+	// DefaultPolicyArn is attached to iam users of roles with no policy configured
+	DefaultPolicyArn = "urn:ecs:iam:::policy/ECSS3FullAccess"
+)
+
 type Role struct {
-	Name       string        `json:"-"`
-	Username   string        `json:"username"`
-	AccessKeys []*AccessKey  `json:"access_keys"`
-	Namespace  string        `json:"namespace"`
-	TTL        time.Duration `json:"ttl"`
-	MaxTTL     time.Duration `json:"max_ttl"`
+	Name           string       `json:"-"`
+	Username       string       `json:"username"`
+	SafeId         string       `json:"safe_id,omitempty"`
+	AccessKeys     []*AccessKey `json:"access_keys"`
+	Namespace      string       `json:"namespace"`
+	Connection     string       `json:"connection,omitempty"`
+	CredentialType string       `json:"credential_type,omitempty"`
+	UserType       string       `json:"user_type,omitempty"`
+	// ExistingKeyExpiryMins keeps the previous object user secret key valid this long after a rotation
+	ExistingKeyExpiryMins int  `json:"existing_key_expiry_time_mins,omitempty"`
+	Locked                bool `json:"locked,omitempty"`
+	// AuthTypes are the apis object users get credentials for, s3 when empty
+	AuthTypes     []string `json:"auth_types,omitempty"`
+	SwiftGroups   []string `json:"swift_groups,omitempty"`
+	SwiftPassword string   `json:"swift_password,omitempty"`
+	// SwiftLeases counts the outstanding leases handing out the swift password
+	SwiftLeases    int               `json:"swift_leases,omitempty"`
+	RoleArn        string            `json:"role_arn,omitempty"`
+	PolicyArns     []string          `json:"policy_arns,omitempty"`
+	PolicyDocument string            `json:"policy_document,omitempty"`
+	Groups         []string          `json:"groups,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	TTL            time.Duration     `json:"ttl"`
+	MaxTTL         time.Duration     `json:"max_ttl"`
+	RotationPeriod time.Duration     `json:"rotation_period,omitempty"`
+	// RotationWindow restricts scheduled rotations to a daily UTC time range such as 01:00-05:00
+	RotationWindow   string    `json:"rotation_window,omitempty"`
+	LastRotated      time.Time `json:"last_rotated,omitempty"`
+	NextRotation     time.Time `json:"next_rotation,omitempty"`
+	RotationFailures int       `json:"rotation_failures,omitempty"`
 }
 
 func (r *Role) ToResponseData() map[string]interface{} {
@@ -18,46 +71,156 @@ func (r *Role) ToResponseData() map[string]interface{} {
 		"ttl":             r.TTL.Seconds(),
 		"max_ttl":         r.MaxTTL.Seconds(),
 		"username":        r.Username,
-		"access_key_id_1": r.AccessKeys[0].AccessKeyId,
-		"create_date_1":   r.AccessKeys[0].CreateDate,
+		"safe_id":         r.SafeId,
+		"access_key_id_1": "n/a",
+		"create_date_1":   "n/a",
 		"access_key_id_2": "n/a",
 		"create_date_2":   "n/a",
 		"namespace":       r.Namespace,
+		"connection":      r.GetConnection(),
+		"credential_type": r.GetCredentialType(),
+		"user_type":       r.GetUserType(),
+		"role_arn":        r.RoleArn,
+		"policy_arns":     r.GetPolicyArns(),
+		"policy_document": r.PolicyDocument,
+		"groups":          r.Groups,
+		"tags":            r.Tags,
+		"rotation_period": r.RotationPeriod.Seconds(),
+		"rotation_window": r.RotationWindow,
+		"last_rotated":    FormatTime(r.LastRotated),
+		"next_rotation":   FormatTime(r.NextRotation),
+	}
+	if r.IsObjectUser() {
+		respData["existing_key_expiry_time_mins"] = r.ExistingKeyExpiryMins
+		respData["locked"] = r.Locked
+		respData["auth_types"] = r.GetAuthTypes()
+		if r.HasSwift() {
+			respData["swift_groups"] = r.SwiftGroups
+			respData["swift_password_set"] = r.SwiftPassword != ""
+		}
+	}
+	if len(r.AccessKeys) > 0 {
+		respData["access_key_id_1"] = r.AccessKeys[0].AccessKeyId
+		respData["create_date_1"] = r.AccessKeys[0].CreateDate
+		respData["vault_owned_1"] = !r.AccessKeys[0].Imported
+		if r.AccessKeys[0].ExpiryDate != "" {
+			respData["expiry_date_1"] = r.AccessKeys[0].ExpiryDate
+		}
 	}
 	if len(r.AccessKeys) == 2 {
 		respData["access_key_id_2"] = r.AccessKeys[1].AccessKeyId
 		respData["create_date_2"] = r.AccessKeys[1].CreateDate
+		respData["vault_owned_2"] = !r.AccessKeys[1].Imported
+		if r.AccessKeys[1].ExpiryDate != "" {
+			respData["expiry_date_2"] = r.AccessKeys[1].ExpiryDate
+		}
 	}
 	return respData
 }
 
+// GetCredentialType defaults to static keys for roles stored before credential types existed
+func (r *Role) GetCredentialType() string {
+	if r.CredentialType == "" {
+		return CredentialTypeStaticKeys
+	}
+	return r.CredentialType
+}
+
+// GetConnection defaults to the connection configured at config
+func (r *Role) GetConnection() string {
+	if r.Connection == "" {
+		return DefaultConnection
+	}
+	return r.Connection
+}
+
+// GetPolicyArns falls back to the default policy when the role defines neither managed nor inline policy,
+// object users have no policies. The iam user of an assumed_role role only signs AssumeRole calls, which the
+// trust policy of the role allows, so it gets no default policy.
+func (r *Role) GetPolicyArns() []string {
+	if r.IsObjectUser() {
+		return nil
+	}
+	if len(r.PolicyArns) == 0 && r.PolicyDocument == "" && !r.IsAssumedRole() {
+		return []string{DefaultPolicyArn}
+	}
+	return r.PolicyArns
+}
+
+// GetUserType defaults to iam users for roles stored before object users were supported
+func (r *Role) GetUserType() string {
+	if r.UserType == "" {
+		return UserTypeIamUser
+	}
+	return r.UserType
+}
+
+func (r *Role) IsObjectUser() bool {
+	return r.UserType == UserTypeObjectUser
+}
+
+// GetAuthTypes defaults to s3 only
+func (r *Role) GetAuthTypes() []string {
+	if len(r.AuthTypes) == 0 {
+		return []string{AuthTypeS3}
+	}
+	return r.AuthTypes
+}
+
+// HasS3 tells whether the role hands out s3 keys, always true for iam users
+func (r *Role) HasS3() bool {
+	return !r.IsObjectUser() || slices.Contains(r.GetAuthTypes(), AuthTypeS3)
+}
+
+func (r *Role) HasSwift() bool {
+	return r.IsObjectUser() && slices.Contains(r.GetAuthTypes(), AuthTypeSwift)
+}
+
+func (r *Role) IsDynamic() bool {
+	return r.CredentialType == CredentialTypeDynamicUser
+}
+
+func (r *Role) IsAssumedRole() bool {
+	return r.CredentialType == CredentialTypeAssumedRole
+}
+
+// NewestKey returns the newest key whose secret is known, imported keys may come without secret
 func (r *Role) NewestKey() (*AccessKey, error) {
-	if len(r.AccessKeys) == 1 {
-		return r.AccessKeys[0], nil
+	var keys []*AccessKey
+	for _, key := range r.AccessKeys {
+		if key.SecretAccessKey != "" {
+			keys = append(keys, key)
+		}
 	}
-	d1, err := time.Parse(time.RFC3339, r.AccessKeys[0].CreateDate)
+	if len(keys) == 0 {
+		return nil, errors.New("role has no access key")
+	}
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+	d1, err := keys[0].created()
 	if err != nil {
 		return nil, err
 	}
-	d2, err := time.Parse(time.RFC3339, r.AccessKeys[1].CreateDate)
+	d2, err := keys[1].created()
 	if err != nil {
 		return nil, err
 	}
 	if d1.After(d2) {
-		return r.AccessKeys[0], nil
+		return keys[0], nil
 	}
-	return r.AccessKeys[1], nil
+	return keys[1], nil
 }
 
 func (r *Role) OldestKeyId() (string, error) {
-	if len(r.AccessKeys) == 1 {
+	if len(r.AccessKeys) < 2 {
 		return "", nil
 	}
-	d1, err := time.Parse(time.RFC3339, r.AccessKeys[0].CreateDate)
+	d1, err := r.AccessKeys[0].created()
 	if err != nil {
 		return "", err
 	}
-	d2, err := time.Parse(time.RFC3339, r.AccessKeys[1].CreateDate)
+	d2, err := r.AccessKeys[1].created()
 	if err != nil {
 		return "", err
 	}
@@ -67,6 +230,33 @@ func (r *Role) OldestKeyId() (string, error) {
 	return r.AccessKeys[1].AccessKeyId, nil
 }
 
+// created is the creation date of the key. Keys listed without one, as RGW lists them, count as older
+// than any dated key: they were there before the plugin created its own.
+func (k *AccessKey) created() (time.Time, error) {
+	if k.CreateDate == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, k.CreateDate)
+}
+
+// OldestKeyAge is the age of the oldest access key of the role, false when the role has no dated key
+func (r *Role) OldestKeyAge(now time.Time) (time.Duration, bool) {
+	var oldest time.Time
+	for _, key := range r.AccessKeys {
+		created, err := time.Parse(time.RFC3339, key.CreateDate)
+		if err != nil {
+			continue
+		}
+		if oldest.IsZero() || created.Before(oldest) {
+			oldest = created
+		}
+	}
+	if oldest.IsZero() {
+		return 0, false
+	}
+	return now.Sub(oldest), true
+}
+
 func (r *Role) SetAccessKey(oldestKeyId string, key *AccessKey) {
 	if oldestKeyId == "" {
 		r.AccessKeys = append(r.AccessKeys, key)
@@ -78,3 +268,118 @@ func (r *Role) SetAccessKey(oldestKeyId string, key *AccessKey) {
 		}
 	}
 }
+
+// KeyById returns the role key with the given id, nil when the role does not hold it
+func (r *Role) KeyById(accessKeyId string) *AccessKey {
+	for _, key := range r.AccessKeys {
+		if key.AccessKeyId == accessKeyId {
+			return key
+		}
+	}
+	return nil
+}
+
+// KeyBySecret returns the role key with the given secret, object user keys all share the user name as id
+func (r *Role) KeyBySecret(secret string) *AccessKey {
+	for _, key := range r.AccessKeys {
+		if key.SecretAccessKey == secret {
+			return key
+		}
+	}
+	return nil
+}
+
+// KeepLeases carries the lease counts of the previous role keys over to the same keys listed again
+func (r *Role) KeepLeases(previous []*AccessKey) {
+	for _, key := range r.AccessKeys {
+		for _, old := range previous {
+			if key.AccessKeyId == old.AccessKeyId && key.SecretAccessKey == old.SecretAccessKey {
+				key.Leases = old.Leases
+			}
+		}
+	}
+}
+
+// RemoveAccessKey drops the given key from the role, returns false if the role did not hold it
+func (r *Role) RemoveAccessKey(accessKeyId string) bool {
+	for i, key := range r.AccessKeys {
+		if key.AccessKeyId == accessKeyId {
+			r.AccessKeys = append(r.AccessKeys[:i], r.AccessKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveSecretKey drops the key with the given secret, object user keys all share the user name as id
+func (r *Role) RemoveSecretKey(secret string) bool {
+	for i, key := range r.AccessKeys {
+		if key.SecretAccessKey == secret {
+			r.AccessKeys = append(r.AccessKeys[:i], r.AccessKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduleNextRotation plans the next scheduled rotation one rotation period after the given time
+func (r *Role) ScheduleNextRotation(from time.Time) {
+	r.RotationFailures = 0
+	if r.RotationPeriod <= 0 {
+		r.NextRotation = time.Time{}
+		return
+	}
+	r.NextRotation = from.Add(r.RotationPeriod)
+}
+
+// RotationDue tells whether a scheduled rotation must run now
+func (r *Role) RotationDue(now time.Time) bool {
+	if r.RotationPeriod <= 0 || r.IsDynamic() || r.NextRotation.IsZero() || now.Before(r.NextRotation) {
+		return false
+	}
+	if r.RotationWindow == "" {
+		return true
+	}
+	start, end, err := ParseRotationWindow(r.RotationWindow)
+	if err != nil {
+		return false
+	}
+	offset := sinceMidnight(now.UTC())
+	if start <= end {
+		return offset >= start && offset < end
+	}
+	// window spans midnight
+	return offset >= start || offset < end
+}
+
+// ParseRotationWindow parses a HH:MM-HH:MM window into offsets since midnight
+func ParseRotationWindow(window string) (time.Duration, time.Duration, error) {
+	startStr, endStr, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("rotation window %s must be formatted HH:MM-HH:MM", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("rotation window %s: %w", window, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("rotation window %s: %w", window, err)
+	}
+	if start.Equal(end) {
+		return 0, 0, fmt.Errorf("rotation window %s is empty", window)
+	}
+	return sinceMidnight(start), sinceMidnight(end), nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// FormatTime returns RFC3339 dates in responses, n/a for unset dates
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return "n/a"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,16 @@
+package model
+
+// RgwUser is returned by the Ceph RGW admin ops user info api
+type RgwUser struct {
+	UserId      string   `json:"user_id"`
+	DisplayName string   `json:"display_name"`
+	Suspended   int      `json:"suspended"`
+	Keys        []RgwKey `json:"keys"`
+}
+
+// RgwKey is an s3 key of a Ceph RGW user, User is the tenant qualified user id
+type RgwKey struct {
+	User      string `json:"user"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
@@ -0,0 +1,148 @@
+package os2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/logical"
+	pwdGen "github.com/sethvargo/go-password/password"
+	"os2/model"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ECS management users passwords must be 8 to 128 characters long and mix upper case, lower case, digit and special characters
+	ecsMinPwdLength = 8
+	ecsMaxPwdLength = 128
+
+	defaultPwdLength     = 24
+	defaultPwdNumDigits  = 1
+	defaultPwdNumSymbols = 1
+	defaultPwdSymbols    = "!@#$%^&"
+
+	// swift passwords are only used by applications, they are long and symbol free to stay header friendly
+	swiftPwdLength    = 32
+	swiftPwdNumDigits = 8
+
+	// generated passwords miss a character class now and then, give a few chances before failing
+	pwdGenerationAttempts = 10
+)
+
+// generatePwd generates a management password from the config vault password policy, or from its explicit parameters
+func generatePwd(ctx context.Context, system logical.SystemView, config *model.PluginConfig) (string, error) {
+	var lastErr error
+	for i := 0; i < pwdGenerationAttempts; i++ {
+		var pwd string
+		var err error
+		if config.PasswordPolicy != "" {
+			pwd, err = system.GeneratePasswordFromPolicy(ctx, config.PasswordPolicy)
+			if err != nil {
+				return "", fmt.Errorf("generating password from policy %s: %w", config.PasswordPolicy, err)
+			}
+		} else {
+			pwd, err = generatePwdFromParams(config)
+			if err != nil {
+				return "", err
+			}
+		}
+		if lastErr = validateEcsPwd(pwd); lastErr == nil {
+			return pwd, nil
+		}
+	}
+	return "", fmt.Errorf("generated password does not meet ECS complexity rules: %w", lastErr)
+}
+
+func generatePwdFromParams(config *model.PluginConfig) (string, error) {
+	length, numDigits, numSymbols, symbols := pwdParams(config)
+	gen, err := pwdGen.NewGenerator(&pwdGen.GeneratorInput{
+		Symbols: symbols})
+	if err != nil {
+		return "", err
+	}
+	numLetters := length - numDigits - numSymbols
+	allowRepeat := numLetters > len(pwdGen.LowerLetters+pwdGen.UpperLetters) || numDigits > len(pwdGen.Digits) || numSymbols > len(symbols)
+	return gen.Generate(length, numDigits, numSymbols, false, allowRepeat)
+}
+
+func generateSwiftPwd() (string, error) {
+	return pwdGen.Generate(swiftPwdLength, swiftPwdNumDigits, 0, false, true)
+}
+
+// pwdParams applies the defaults to the unset password parameters of the config
+func pwdParams(config *model.PluginConfig) (length, numDigits, numSymbols int, symbols string) {
+	length, numDigits, numSymbols, symbols = config.PasswordLength, config.PasswordNumDigits, config.PasswordNumSymbols, config.PasswordSymbols
+	if length == 0 {
+		length = defaultPwdLength
+	}
+	if numDigits == 0 {
+		numDigits = defaultPwdNumDigits
+	}
+	if numSymbols == 0 {
+		numSymbols = defaultPwdNumSymbols
+	}
+	if symbols == "" {
+		symbols = defaultPwdSymbols
+	}
+	return
+}
+
+// validatePwdParams checks the explicit password parameters can produce passwords ECS accepts
+func validatePwdParams(config *model.PluginConfig) error {
+	length, numDigits, numSymbols, symbols := pwdParams(config)
+	if length < ecsMinPwdLength || length > ecsMaxPwdLength {
+		return fmt.Errorf("password_length must be between %d and %d", ecsMinPwdLength, ecsMaxPwdLength)
+	}
+	if numDigits < 1 || numSymbols < 1 {
+		return errors.New("password_num_digits and password_num_symbols must be at least 1")
+	}
+	// keep room for at least one lower and one upper case letter
+	if numDigits+numSymbols > length-2 {
+		return errors.New("password_num_digits and password_num_symbols leave no room for letters")
+	}
+	for _, c := range symbols {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsSpace(c) {
+			return fmt.Errorf("password_symbols must only hold special characters, got %q", c)
+		}
+	}
+	return nil
+}
+
+// validateEcsPwd checks a password against the ECS management user complexity rules
+func validateEcsPwd(pwd string) error {
+	if len(pwd) < ecsMinPwdLength || len(pwd) > ecsMaxPwdLength {
+		return fmt.Errorf("password must be between %d and %d characters", ecsMinPwdLength, ecsMaxPwdLength)
+	}
+	var upper, lower, digit, special bool
+	for _, c := range pwd {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsSpace(c):
+			return errors.New("password must not contain spaces")
+		default:
+			special = true
+		}
+	}
+	var missing []string
+	if !upper {
+		missing = append(missing, "upper case letter")
+	}
+	if !lower {
+		missing = append(missing, "lower case letter")
+	}
+	if !digit {
+		missing = append(missing, "digit")
+	}
+	if !special {
+		missing = append(missing, "special character")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password is missing a %s", strings.Join(missing, ", a "))
+	}
+	return nil
+}
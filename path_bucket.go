@@ -0,0 +1,395 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"time"
+)
+
+const bucketHeadType = "s3"
+
+func pathBucket(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "bucket/" + framework.GenericNameRegex("namespace") + "/" + framework.GenericNameRegex("bucket"),
+			Fields: map[string]*framework.FieldSchema{
+				"namespace": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Namespace of the bucket",
+					Required:    true,
+				},
+				"bucket": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the bucket",
+					Required:    true,
+				},
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS connection the bucket lives on, the one configured at config when empty.",
+				},
+				"owner": {
+					Type:        framework.TypeString,
+					Description: "Object user owning the bucket.",
+				},
+				"replication_group": {
+					Type:        framework.TypeString,
+					Description: "Replication group of the bucket, the namespace default one when empty. It cannot be changed once the bucket is created.",
+				},
+				"quota_hard_gb": {
+					Type:        framework.TypeInt,
+					Description: "Size in GB above which writes are blocked. 0 removes the quota.",
+				},
+				"quota_soft_gb": {
+					Type:        framework.TypeInt,
+					Description: "Size in GB above which ECS raises a notification. 0 removes the quota.",
+				},
+				"retention": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Default retention period of the bucket objects.",
+				},
+				"versioning": {
+					Type:        framework.TypeBool,
+					Description: "Whether object versioning is enabled. Set through the s3 api with the keys of role, so it requires role and s3_url in the config.",
+				},
+				"role": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Role whose iam or object user is granted full access to the bucket through the bucket policy. Dynamic user roles cannot be bound.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathBucketRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathBucketWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathBucketUpdate,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathBucketDelete,
+				},
+			},
+			ExistenceCheck:  b.pathBucketExistenceCheck,
+			HelpSynopsis:    pathBucketHelpSynopsis,
+			HelpDescription: pathBucketHelpDescription,
+		},
+		{
+			Pattern: "bucket/" + framework.GenericNameRegex("namespace") + "/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"namespace": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Namespace of the buckets",
+					Required:    true,
+				},
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS connection, the one configured at config when empty.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathBucketsList,
+				},
+			},
+		},
+	}
+}
+
+// pathBucketExistenceCheck asks ECS, buckets may have been created outside of vault
+func (b *backend) pathBucketExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "buckets")
+	if err != nil {
+		return false, err
+	}
+	bucket, err := client.getBucket(ctx, d.Get("namespace").(string), d.Get("bucket").(string))
+	if err != nil {
+		return false, fmt.Errorf("existence check failed: %w", err)
+	}
+	return bucket != nil, nil
+}
+
+func (b *backend) pathBucketsList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "buckets")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	buckets, err := client.listBuckets(ctx, d.Get("namespace").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	names := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		names = append(names, bucket.Name)
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathBucketWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	managed := &model.ManagedBucket{
+		Name:       d.Get("bucket").(string),
+		Namespace:  d.Get("namespace").(string),
+		Connection: connectionParam(d),
+		Role:       d.Get("role").(string),
+		Versioning: d.Get("versioning").(bool),
+	}
+	role, err := bucketRole(ctx, req.Storage, managed)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	client, err := b.getEcsClient(ctx, req.Storage, managed.Connection, "buckets")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	err = client.createBucket(ctx, model.BucketCreate{
+		Name:      managed.Name,
+		Namespace: managed.Namespace,
+		Vpool:     d.Get("replication_group").(string),
+		Owner:     d.Get("owner").(string),
+		HeadType:  bucketHeadType,
+		Retention: int64(d.Get("retention").(int)),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	// from here the bucket exists, each step is stored once done so that an update can finish a failed creation
+	roleName, versioning := managed.Role, managed.Versioning
+	managed.Role, managed.Versioning = "", false
+	if err := setManagedBucket(ctx, req.Storage, managed); err != nil {
+		return logical.ErrorResponse("bucket created but storing it failed: %s", err), nil
+	}
+	hardGb, softGb := d.Get("quota_hard_gb").(int), d.Get("quota_soft_gb").(int)
+	if hardGb > 0 || softGb > 0 {
+		if err := client.setBucketQuota(ctx, managed.Namespace, managed.Name, int64(hardGb), int64(softGb)); err != nil {
+			return logical.ErrorResponse("bucket created but setting its quota failed: %s", err), nil
+		}
+	}
+	if role != nil {
+		if err := client.bindBucketUser(ctx, managed.Namespace, managed.Name, roleName, role); err != nil {
+			return logical.ErrorResponse("bucket created but binding role %s failed: %s", roleName, err), nil
+		}
+		managed.Role = roleName
+		if err := setManagedBucket(ctx, req.Storage, managed); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if versioning {
+		managed.Versioning = true
+		if err := setBucketVersioning(ctx, client, role, managed); err != nil {
+			return logical.ErrorResponse("bucket created but enabling versioning failed: %s", err), nil
+		}
+		if err := setManagedBucket(ctx, req.Storage, managed); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *backend) pathBucketUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	namespace, name, connection := d.Get("namespace").(string), d.Get("bucket").(string), connectionParam(d)
+	client, err := b.getEcsClient(ctx, req.Storage, connection, "buckets")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	bucket, err := client.getBucket(ctx, namespace, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if bucket == nil {
+		return logical.ErrorResponse("bucket %s not found in namespace %s", name, namespace), nil
+	}
+	managed, err := getManagedBucket(ctx, req.Storage, connection, namespace, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if managed == nil {
+		// the bucket was not created by vault, it is managed from now on
+		managed = &model.ManagedBucket{Name: name, Namespace: namespace, Connection: connection}
+	}
+	if replicationGroup, ok := d.GetOk("replication_group"); ok && replicationGroup.(string) != bucket.Vpool {
+		return logical.ErrorResponse("replication_group cannot be changed"), nil
+	}
+	if owner, ok := d.GetOk("owner"); ok && owner.(string) != bucket.Owner {
+		if err := client.setBucketOwner(ctx, namespace, name, owner.(string)); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	hardGb, okHard := d.GetOk("quota_hard_gb")
+	softGb, okSoft := d.GetOk("quota_soft_gb")
+	if okHard || okSoft {
+		if !okHard {
+			hardGb = int(positiveGb(bucket.BlockSize))
+		}
+		if !okSoft {
+			softGb = int(positiveGb(bucket.NotificationSize))
+		}
+		if err := client.setBucketQuota(ctx, namespace, name, int64(hardGb.(int)), int64(softGb.(int))); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if retention, ok := d.GetOk("retention"); ok {
+		if err := client.setBucketRetention(ctx, namespace, name, time.Duration(retention.(int))*time.Second); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if roleName, ok := d.GetOk("role"); ok && roleName.(string) != managed.Role {
+		if managed.Role != "" {
+			if err := client.unbindBucketUser(ctx, namespace, name, managed.Role); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+		managed.Role = roleName.(string)
+		role, err := bucketRole(ctx, req.Storage, managed)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role != nil {
+			if err := client.bindBucketUser(ctx, namespace, name, managed.Role, role); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+	if versioning, ok := d.GetOk("versioning"); ok && versioning.(bool) != managed.Versioning {
+		// ECS buckets cannot go back to unversioned, disabling suspends versioning
+		managed.Versioning = versioning.(bool)
+		role, err := bucketRole(ctx, req.Storage, managed)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if err := setBucketVersioning(ctx, client, role, managed); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if err := setManagedBucket(ctx, req.Storage, managed); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return nil, nil
+}
+
+func (b *backend) pathBucketRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	namespace, name, connection := d.Get("namespace").(string), d.Get("bucket").(string), connectionParam(d)
+	client, err := b.getEcsClient(ctx, req.Storage, connection, "buckets")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	bucket, err := client.getBucket(ctx, namespace, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if bucket == nil {
+		return logical.ErrorResponse("bucket not found"), nil
+	}
+	managed, err := getManagedBucket(ctx, req.Storage, connection, namespace, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	data := map[string]interface{}{
+		"bucket":            bucket.Name,
+		"namespace":         bucket.Namespace,
+		"owner":             bucket.Owner,
+		"replication_group": bucket.Vpool,
+		"quota_hard_gb":     positiveGb(bucket.BlockSize),
+		"quota_soft_gb":     positiveGb(bucket.NotificationSize),
+		"retention":         bucket.Retention,
+		"created":           bucket.Created,
+		"managed":           managed != nil,
+	}
+	if managed != nil {
+		data["role"] = managed.Role
+		data["versioning"] = managed.Versioning
+	}
+	return &logical.Response{Data: data}, nil
+}
+
+// pathBucketDelete deletes the bucket on ECS, which refuses it while the bucket is not empty
+func (b *backend) pathBucketDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	namespace, name, connection := d.Get("namespace").(string), d.Get("bucket").(string), connectionParam(d)
+	client, err := b.getEcsClient(ctx, req.Storage, connection, "buckets")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := client.deleteBucket(ctx, namespace, name); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := req.Storage.Delete(ctx, bucketStorageKey(connection, namespace, name)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return nil, nil
+}
+
+// bucketRole returns the role bound to the bucket, nil when there is none
+func bucketRole(ctx context.Context, storage logical.Storage, managed *model.ManagedBucket) (*model.Role, error) {
+	if managed.Role == "" {
+		return nil, nil
+	}
+	role, err := getRole(ctx, storage, managed.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s not found", managed.Role)
+	}
+	if role.IsDynamic() {
+		return nil, fmt.Errorf("role %s creates an iam user per lease, it cannot be bound to a bucket", managed.Role)
+	}
+	if role.Namespace != managed.Namespace || role.Connection != managed.Connection {
+		return nil, fmt.Errorf("role %s does not belong to the namespace and connection of the bucket", managed.Role)
+	}
+	return role, nil
+}
+
+func setBucketVersioning(ctx context.Context, client *ecsClient, role *model.Role, managed *model.ManagedBucket) error {
+	if role == nil {
+		return fmt.Errorf("versioning requires a role to sign the s3 request with")
+	}
+	key, err := role.NewestKey()
+	if err != nil {
+		return err
+	}
+	return client.setBucketVersioning(ctx, key, managed.Name, managed.Versioning)
+}
+
+func bucketStorageKey(connection, namespace, name string) string {
+	if connection == "" {
+		connection = defaultConnection
+	}
+	return "bucket/" + connection + "/" + namespace + "/" + name
+}
+
+func getManagedBucket(ctx context.Context, s logical.Storage, connection, namespace, name string) (*model.ManagedBucket, error) {
+	entry, err := s.Get(ctx, bucketStorageKey(connection, namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var managed model.ManagedBucket
+	if err := entry.DecodeJSON(&managed); err != nil {
+		return nil, err
+	}
+	managed.Name = name
+	return &managed, nil
+}
+
+func setManagedBucket(ctx context.Context, s logical.Storage, managed *model.ManagedBucket) error {
+	entry, err := logical.StorageEntryJSON(bucketStorageKey(managed.Connection, managed.Namespace, managed.Name), managed)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+const pathBucketHelpSynopsis = `Manages the ECS buckets of a namespace, at bucket/<namespace>/<bucket>.`
+
+const pathBucketHelpDescription = `
+Creates, reads, updates and deletes ECS buckets through the management api.
+owner, quota_hard_gb, quota_soft_gb and retention can be changed after creation, replication_group cannot.
+role grants the iam user of a static_keys or assumed_role role full access to the bucket through a
+statement of the bucket policy, other statements are left untouched. versioning is set through the s3
+api, with the keys of role, so it requires role and s3_url in the connection config.
+Deleting a bucket fails while it still holds objects.
+`
@@ -2,57 +2,63 @@ package os2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os2/model"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-const configStoragePath = "config"
+const (
+	configStoragePath = "config"
+	// defaultConnection is the connection configured at config, used by roles with no connection
+	defaultConnection = model.DefaultConnection
+	// rotateConnection cannot name a connection, config/rotate rotates the default connection password
+	rotateConnection = "rotate"
+)
 
 func pathConfig(b *backend) []*framework.Path {
 	return []*framework.Path{
 		{
-			Pattern: "config",
-			Fields: map[string]*framework.FieldSchema{
-				"username": {
-					Type:        framework.TypeString,
-					Description: "username to access dell ecs api",
-					Required:    true,
-					DisplayAttrs: &framework.DisplayAttributes{
-						Name:      "username",
-						Sensitive: false,
-					},
+			Pattern: "config/rotate",
+			Fields:  map[string]*framework.FieldSchema{},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateWrite,
 				},
-				"password": {
-					Type:        framework.TypeString,
-					Description: "password to access dell ecs api",
-					Required:    true,
-					DisplayAttrs: &framework.DisplayAttributes{
-						Name:      "password",
-						Sensitive: true,
-					},
+			},
+			ExistenceCheck: b.pathConfigExistenceCheck,
+		},
+		{
+			Pattern: "config/" + framework.GenericNameRegex("connection") + "/rotate",
+			Fields: map[string]*framework.FieldSchema{
+				"connection": connectionField(),
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateRead,
 				},
-				"url": {
-					Type:        framework.TypeString,
-					Description: "url to access dell ecs api",
-					Required:    true,
-					DisplayAttrs: &framework.DisplayAttributes{
-						Name:      "url",
-						Sensitive: false,
-					},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateWrite,
 				},
-				"skip_ssl": {
-					Type:        framework.TypeBool,
-					Description: "whether to skip or not ssl verify when accessing dell ecs api",
-					Required:    true,
-					DisplayAttrs: &framework.DisplayAttributes{
-						Name:      "skip_ssl",
-						Sensitive: false,
-					},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathConfigRotateWrite,
 				},
 			},
+			ExistenceCheck: b.pathConfigExistenceCheck,
+		},
+		{
+			Pattern: "config",
+			Fields:  configFields(),
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
 					Callback: b.pathConfigRead,
@@ -64,63 +70,402 @@ func pathConfig(b *backend) []*framework.Path {
 					Callback: b.pathConfigWrite,
 				},
 			},
-			ExistenceCheck:  b.pathExistenceCheck,
+			ExistenceCheck:  b.pathConfigExistenceCheck,
 			HelpSynopsis:    pathConfigHelpSynopsis,
 			HelpDescription: pathConfigHelpDescription,
 		},
 		{
-			Pattern: "config/rotate",
-			Fields:  map[string]*framework.FieldSchema{},
+			Pattern: "config/" + framework.GenericNameRegex("connection"),
+			Fields:  withConnectionField(configFields()),
 			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathConfigRead,
+				},
 				logical.CreateOperation: &framework.PathOperation{
-					Callback: b.pathConfigRotateWrite,
+					Callback: b.pathConfigWrite,
 				},
 				logical.UpdateOperation: &framework.PathOperation{
-					Callback: b.pathConfigRotateWrite,
+					Callback: b.pathConfigWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathConfigDelete,
 				},
 			},
-			ExistenceCheck: b.pathExistenceCheck,
+			ExistenceCheck:  b.pathConfigExistenceCheck,
+			HelpSynopsis:    pathConfigHelpSynopsis,
+			HelpDescription: pathConfigHelpDescription,
 		},
+		{
+			Pattern: "config/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathConfigList,
+				},
+			},
+		},
+	}
+}
+
+func configFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"provider": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "type of object store, ecs or ceph_rgw",
+			Default:     model.ProviderEcs,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "provider",
+				Sensitive: false,
+			},
+		},
+		"username": {
+			Type:        framework.TypeString,
+			Description: "username to access dell ecs api, the admin access key for ceph_rgw",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "username",
+				Sensitive: false,
+			},
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "password to access dell ecs api, the admin secret key for ceph_rgw",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password",
+				Sensitive: true,
+			},
+		},
+		"url": {
+			Type:        framework.TypeString,
+			Description: "url to access dell ecs api, the gateway url for ceph_rgw",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "url",
+				Sensitive: false,
+			},
+		},
+		"urls": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "urls of other ECS nodes to fail over to when url does not answer",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "urls",
+				Sensitive: false,
+			},
+		},
+		"s3_url": {
+			Type:        framework.TypeString,
+			Description: "url of the dell ecs s3 api, used to set bucket versioning",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "s3_url",
+				Sensitive: false,
+			},
+		},
+		"skip_ssl": {
+			Type:        framework.TypeBool,
+			Description: "whether to skip or not ssl verify when accessing dell ecs api",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "skip_ssl",
+				Sensitive: false,
+			},
+		},
+		"connect_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "maximum time to connect to a node, including the TLS handshake",
+			Default:     int(model.DefaultConnectTimeout.Seconds()),
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "connect_timeout",
+				Sensitive: false,
+			},
+		},
+		"request_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "maximum time of a single api request, from connecting to reading the response",
+			Default:     int(model.DefaultRequestTimeout.Seconds()),
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "request_timeout",
+				Sensitive: false,
+			},
+		},
+		"max_retries": {
+			Type:        framework.TypeInt,
+			Description: "number of retries, with exponential backoff, of idempotent calls failing with a connection error, a 429 or a 5xx, 0 disables retries",
+			Default:     model.DefaultMaxRetries,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "max_retries",
+				Sensitive: false,
+			},
+		},
+		"max_retry_backoff": {
+			Type:        framework.TypeDurationSecond,
+			Description: "maximum wait between two retries",
+			Default:     int(model.DefaultMaxRetryBackoff.Seconds()),
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "max_retry_backoff",
+				Sensitive: false,
+			},
+		},
+		"breaker_threshold": {
+			Type:        framework.TypeInt,
+			Description: "number of consecutive failed calls after which calls fail fast for breaker_cooldown, 0 disables the circuit breaker",
+			Default:     model.DefaultBreakerThreshold,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "breaker_threshold",
+				Sensitive: false,
+			},
+		},
+		"breaker_cooldown": {
+			Type:        framework.TypeDurationSecond,
+			Description: "how long calls fail fast once the circuit breaker is open",
+			Default:     int(model.DefaultBreakerCooldown.Seconds()),
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "breaker_cooldown",
+				Sensitive: false,
+			},
+		},
+		"password_rotation_period": {
+			Type:        framework.TypeDurationSecond,
+			Description: "period after which the password is rotated automatically, 0 disables scheduled rotation",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_rotation_period",
+				Sensitive: false,
+			},
+		},
+		"password_policy": {
+			Type:        framework.TypeString,
+			Description: "name of the vault password policy generating rotated passwords, takes precedence over the other password fields",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_policy",
+				Sensitive: false,
+			},
+		},
+		"password_length": {
+			Type:        framework.TypeInt,
+			Description: "length of rotated passwords, between 8 and 128",
+			Default:     defaultPwdLength,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_length",
+				Sensitive: false,
+			},
+		},
+		"password_num_digits": {
+			Type:        framework.TypeInt,
+			Description: "number of digits in rotated passwords",
+			Default:     defaultPwdNumDigits,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_num_digits",
+				Sensitive: false,
+			},
+		},
+		"password_num_symbols": {
+			Type:        framework.TypeInt,
+			Description: "number of special characters in rotated passwords",
+			Default:     defaultPwdNumSymbols,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_num_symbols",
+				Sensitive: false,
+			},
+		},
+		"password_symbols": {
+			Type:        framework.TypeString,
+			Description: "special characters rotated passwords are made of",
+			Default:     defaultPwdSymbols,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "password_symbols",
+				Sensitive: false,
+			},
+		},
+	}
+}
+
+func connectionField() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: "name of the ECS connection",
+		Required:    true,
+	}
+}
+
+func withConnectionField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["connection"] = connectionField()
+	return fields
+}
+
+// connectionName is the connection of the config path, the default one for paths with no connection in them
+func connectionName(data *framework.FieldData) string {
+	if _, ok := data.Schema["connection"]; ok {
+		if name := data.Get("connection").(string); name != "" {
+			return name
+		}
 	}
+	return defaultConnection
+}
+
+// connectionParam is the connection field of role, bucket and namespace paths, empty for the default connection
+// as roles and buckets store it
+func connectionParam(d *framework.FieldData) string {
+	connection := d.Get("connection").(string)
+	if connection == defaultConnection {
+		return ""
+	}
+	return connection
+}
+
+func configStorageKey(connection string) string {
+	if connection == "" || connection == defaultConnection {
+		return configStoragePath
+	}
+	return configStoragePath + "/" + connection
 }
 
 func (b *backend) pathConfigRotateWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := GetConfig(ctx, req.Storage)
+	if err := b.rotateRootPassword(ctx, req.Storage, connectionName(data)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return nil, nil
+
+}
+
+func (b *backend) pathConfigRotateRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := GetConfig(ctx, req.Storage, connectionName(data))
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
-	client, err := b.getClient(ctx, req.Storage)
+	if config == nil {
+		return logical.ErrorResponse("missing plugin config"), nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password_rotation_period": config.PasswordRotationPeriod.Seconds(),
+			"last_rotated":             model.FormatTime(config.LastRotated),
+			"next_rotation":            model.FormatTime(config.NextRotation()),
+			"rotation_pending":         config.PendingPassword != "",
+		}}, nil
+}
+
+// rotateRootPassword sets a new generated password on the ECS management user and stores it in config.
+// The new password is stored as pending before ECS is changed, and only promoted once a login with it succeeds,
+// so a failure at any step leaves a working password in storage.
+func (b *backend) rotateRootPassword(ctx context.Context, storage logical.Storage, connection string) error {
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+
+	config, err := GetConfig(ctx, storage, connection)
 	if err != nil {
-		return logical.ErrorResponse("getting API client", err), nil
+		return err
 	}
-	pwd, err := client.rotatePwd(config.Username)
+	if config == nil {
+		return errors.New("missing plugin config")
+	}
+	if config.PendingPassword != "" {
+		if err := b.resolvePendingPassword(ctx, storage, connection, config); err != nil {
+			return err
+		}
+	}
+	client, err := b.getEcsClient(ctx, storage, connection, "management password rotations")
 	if err != nil {
-		return logical.ErrorResponse(" ECS API rotate", err), nil
+		return fmt.Errorf("getting API client: %w", err)
 	}
-	config.Password = pwd
-	if err := b.persistConfig(ctx, *config, req.Storage); err != nil {
-		return logical.ErrorResponse("storing config", err), nil
+	pwd, err := generatePwd(ctx, b.System(), config)
+	if err != nil {
+		return err
 	}
-	return nil, nil
+	config.PendingPassword = pwd
+	if err := b.persistConfig(ctx, connection, *config, storage); err != nil {
+		return fmt.Errorf("storing pending password: %w", err)
+	}
+	if err := client.setPwd(ctx, config.Username, pwd); err != nil {
+		if _, ok := err.(*ApiError); ok {
+			// ECS refused the change, the current password is still valid
+			config.PendingPassword = ""
+			if err := b.persistConfig(ctx, connection, *config, storage); err != nil {
+				b.Logger().Warn("clearing pending password", "error", err)
+			}
+		}
+		return fmt.Errorf("ECS API rotate: %w", err)
+	}
+	if err := checkLogin(ctx, *config, pwd); err != nil {
+		return fmt.Errorf("login with rotated password: %w", err)
+	}
+	return b.promotePendingPassword(ctx, storage, connection, config)
+}
+
+func (b *backend) promotePendingPassword(ctx context.Context, storage logical.Storage, connection string, config *model.PluginConfig) error {
+	config.Password = config.PendingPassword
+	config.PendingPassword = ""
+	config.LastRotated = time.Now().UTC()
+	if err := b.persistConfig(ctx, connection, *config, storage); err != nil {
+		return fmt.Errorf("storing config: %w", err)
+	}
+	return nil
+}
+
+// recoverPendingPassword resolves a rotation interrupted between its ECS change and its promotion
+func (b *backend) recoverPendingPassword(ctx context.Context, storage logical.Storage, connection string) error {
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
 
+	config, err := GetConfig(ctx, storage, connection)
+	if err != nil || config == nil || config.PendingPassword == "" {
+		return err
+	}
+	return b.resolvePendingPassword(ctx, storage, connection, config)
+}
+
+func (b *backend) resolvePendingPassword(ctx context.Context, storage logical.Storage, connection string, config *model.PluginConfig) error {
+	if err := checkLogin(ctx, *config, config.PendingPassword); err == nil {
+		b.Logger().Info("promoting pending ECS management password", "connection", connection)
+		return b.promotePendingPassword(ctx, storage, connection, config)
+	}
+	if err := checkLogin(ctx, *config, config.Password); err != nil {
+		return fmt.Errorf("neither the current nor the pending ECS management password work: %w", err)
+	}
+	b.Logger().Info("discarding pending ECS management password, it was never applied", "connection", connection)
+	config.PendingPassword = ""
+	return b.persistConfig(ctx, connection, *config, storage)
 }
 
 func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := GetConfig(ctx, req.Storage)
+	config, err := GetConfig(ctx, req.Storage, connectionName(data))
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
+	if config == nil {
+		return nil, nil
+	}
 	resp := &logical.Response{
 		Data: map[string]interface{}{
+			"provider": config.GetProvider(),
 			"username": config.Username,
 			"password": "<masked>",
 			"url":      config.Url,
+			"urls":     config.Urls,
+			"s3_url":   config.S3Url,
 			"skip_ssl": config.SkipSsl,
+
+			"connect_timeout": config.GetConnectTimeout().Seconds(),
+			"request_timeout": config.GetRequestTimeout().Seconds(),
+
+			"max_retries":       config.GetMaxRetries(),
+			"max_retry_backoff": config.GetMaxRetryBackoff().Seconds(),
+			"breaker_threshold": config.GetBreakerThreshold(),
+			"breaker_cooldown":  config.GetBreakerCooldown().Seconds(),
+
+			"password_rotation_period": config.PasswordRotationPeriod.Seconds(),
+			"last_rotated":             model.FormatTime(config.LastRotated),
+			"password_policy":          config.PasswordPolicy,
+			"password_length":          config.PasswordLength,
+			"password_num_digits":      config.PasswordNumDigits,
+			"password_num_symbols":     config.PasswordNumSymbols,
+			"password_symbols":         config.PasswordSymbols,
 		}}
 	return resp, nil
 }
 
 func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if connectionName(data) == rotateConnection {
+		return logical.ErrorResponse("connection name %s is reserved", rotateConnection), nil
+	}
 	username, okUser := data.GetOk("username")
 	password, okPwd := data.GetOk("password")
 	url, okUrl := data.GetOk("url")
@@ -128,19 +473,110 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 		return logical.ErrorResponse("fields username, password and url are required"), nil
 	}
 	config := model.PluginConfig{
+		Provider: data.Get("provider").(string),
 		Username: username.(string),
 		Password: password.(string),
 		Url:      url.(string),
+		Urls:     data.Get("urls").([]string),
+		S3Url:    data.Get("s3_url").(string),
 		SkipSsl:  data.Get("skip_ssl").(bool),
+
+		ConnectTimeout: time.Duration(data.Get("connect_timeout").(int)) * time.Second,
+		RequestTimeout: time.Duration(data.Get("request_timeout").(int)) * time.Second,
+
+		MaxRetries:       data.Get("max_retries").(int),
+		MaxRetryBackoff:  time.Duration(data.Get("max_retry_backoff").(int)) * time.Second,
+		BreakerThreshold: data.Get("breaker_threshold").(int),
+		BreakerCooldown:  time.Duration(data.Get("breaker_cooldown").(int)) * time.Second,
+
+		PasswordRotationPeriod: time.Duration(data.Get("password_rotation_period").(int)) * time.Second,
+		LastRotated:            time.Now().UTC(),
+	}
+	if config.PasswordRotationPeriod < 0 {
+		return logical.ErrorResponse("password_rotation_period cannot be negative"), nil
+	}
+	if config.ConnectTimeout <= 0 || config.RequestTimeout <= 0 {
+		return logical.ErrorResponse("connect_timeout and request_timeout must be positive"), nil
+	}
+	if config.MaxRetries < 0 || config.BreakerThreshold < 0 {
+		return logical.ErrorResponse("max_retries and breaker_threshold cannot be negative"), nil
+	}
+	if config.MaxRetryBackoff <= 0 || config.BreakerCooldown <= 0 {
+		return logical.ErrorResponse("max_retry_backoff and breaker_cooldown must be positive"), nil
+	}
+	// 0 is stored as -1, unset fields of configs stored before retries existed get the defaults
+	if config.MaxRetries == 0 {
+		config.MaxRetries = -1
+	}
+	if config.BreakerThreshold == 0 {
+		config.BreakerThreshold = -1
+	}
+	if !validProvider(config.Provider) {
+		return logical.ErrorResponse("provider must be %s or %s", model.ProviderEcs, model.ProviderCephRgw), nil
+	}
+	if config.Provider != model.ProviderEcs && config.PasswordRotationPeriod > 0 {
+		return logical.ErrorResponse("password_rotation_period is only supported on ECS connections"), nil
+	}
+	existing, err := GetConfig(ctx, req.Storage, connectionName(data))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
-	if err := b.persistConfig(ctx, config, req.Storage); err != nil {
+	if existing != nil && existing.GetProvider() != config.Provider {
+		// the users of the roles of the connection live in the current object store
+		return logical.ErrorResponse("provider of connection %s cannot be changed from %s, delete it first", connectionName(data), existing.GetProvider()), nil
+	}
+	config.PasswordPolicy = data.Get("password_policy").(string)
+	config.PasswordLength = data.Get("password_length").(int)
+	config.PasswordNumDigits = data.Get("password_num_digits").(int)
+	config.PasswordNumSymbols = data.Get("password_num_symbols").(int)
+	config.PasswordSymbols = data.Get("password_symbols").(string)
+	if config.PasswordPolicy != "" {
+		// fail early on unknown policies rather than at the next rotation
+		if _, err := generatePwd(ctx, b.System(), &config); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	} else if err := validatePwdParams(&config); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := b.persistConfig(ctx, connectionName(data), config, req.Storage); err != nil {
 		return logical.ErrorResponse("storing config", err), nil
 	}
 	return nil, nil
 }
 
-func (b *backend) persistConfig(ctx context.Context, config model.PluginConfig, storage logical.Storage) error {
-	entry, err := logical.StorageEntryJSON(configStoragePath, &config)
+// pathConfigDelete removes a connection no role uses anymore
+func (b *backend) pathConfigDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	connection := connectionName(data)
+	roleNames, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for _, roleName := range roleNames {
+		role, err := getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role != nil && role.GetConnection() == connection {
+			return logical.ErrorResponse("connection %s is used by role %s", connection, roleName), nil
+		}
+	}
+	if err := req.Storage.Delete(ctx, configStorageKey(connection)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	b.reset(connection)
+	return nil, nil
+}
+
+func (b *backend) pathConfigList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	connections, err := listConnections(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return logical.ListResponse(connections), nil
+}
+
+func (b *backend) persistConfig(ctx context.Context, connection string, config model.PluginConfig, storage logical.Storage) error {
+	entry, err := logical.StorageEntryJSON(configStorageKey(connection), &config)
 	if err != nil {
 		return err
 	}
@@ -148,10 +584,18 @@ func (b *backend) persistConfig(ctx context.Context, config model.PluginConfig,
 		return err
 	}
 	// reset client so next invocation will pick up config changes
-	b.reset()
+	b.reset(connection)
 	return nil
 }
 
+func (b *backend) pathConfigExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := GetConfig(ctx, req.Storage, connectionName(data))
+	if err != nil {
+		return false, fmt.Errorf("existence check failed: %w", err)
+	}
+	return config != nil, nil
+}
+
 func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
 	out, err := req.Storage.Get(ctx, req.Path)
 	if err != nil {
@@ -161,8 +605,8 @@ func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request,
 	return out != nil, nil
 }
 
-func GetConfig(ctx context.Context, storage logical.Storage) (*model.PluginConfig, error) {
-	entry, err := storage.Get(ctx, configStoragePath)
+func GetConfig(ctx context.Context, storage logical.Storage, connection string) (*model.PluginConfig, error) {
+	entry, err := storage.Get(ctx, configStorageKey(connection))
 	if err != nil {
 		return nil, err
 	}
@@ -179,8 +623,30 @@ func GetConfig(ctx context.Context, storage logical.Storage) (*model.PluginConfi
 	return config, nil
 }
 
+// listConnections returns the names of the configured connections, the default one included
+func listConnections(ctx context.Context, storage logical.Storage) ([]string, error) {
+	var connections []string
+	entry, err := storage.Get(ctx, configStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		connections = append(connections, defaultConnection)
+	}
+	names, err := storage.List(ctx, configStoragePath+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, "/") {
+			connections = append(connections, name)
+		}
+	}
+	return connections, nil
+}
+
 // pathConfigHelpSynopsis summarizes the help text for the configuration
-const pathConfigHelpSynopsis = `object-store configuration. Fields: username, password, url and skip_ssl. All fields are written/updated, so give them values!`
+const pathConfigHelpSynopsis = `object-store configuration, at config for the default connection or config/<connection> for named ones. Fields: provider, username, password, url, urls, s3_url, skip_ssl, connect_timeout, request_timeout, max_retries, max_retry_backoff, breaker_threshold, breaker_cooldown and password_rotation_period. All fields are written/updated, so give them values!`
 
 // pathConfigHelpDescription describes the help text for the configuration
 const pathConfigHelpDescription = `
@@ -5,9 +5,19 @@ import (
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"time"
 )
 
-const secretAccessKeyType = "secretAccessKey"
+const (
+	secretAccessKeyType   = "secretAccessKey"
+	secretAssumedRoleType = "assumedRole"
+
+	// bounds of the STS DurationSeconds parameter
+	minStsDuration     = 15 * time.Minute
+	maxStsDuration     = 12 * time.Hour
+	defaultStsDuration = time.Hour
+)
 
 func pathCreds(b *backend) *framework.Path {
 	return &framework.Path{
@@ -41,28 +51,139 @@ func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, d *fr
 	if role == nil {
 		return nil, fmt.Errorf("role not found")
 	}
-	accessKey, err := role.NewestKey()
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	if role.IsAssumedRole() {
+		return b.assumedRoleCreds(ctx, req, roleName, role)
+	}
+	if !role.IsDynamic() {
+		// the leases of the shared role key are counted, the revocation of the last one retires the key
+		b.roleLock.Lock()
+		defer b.roleLock.Unlock()
+		role, err = getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role == nil {
+			return nil, fmt.Errorf("role not found")
+		}
+		role.Name = roleName
+	}
+	if role.IsObjectUser() {
+		return b.objectUserCreds(ctx, req.Storage, roleName, role)
+	}
+	var accessKey *model.AccessKey
+	if role.IsDynamic() {
+		client, err := b.getClient(ctx, req.Storage, role.Connection)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		username, err := dynamicUsername(role.Username)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		walId, err := framework.PutWAL(ctx, req.Storage, walDynamicUserKind, &walIamUser{
+			RoleName:   roleName,
+			Namespace:  role.Namespace,
+			Connection: role.Connection,
+			Username:   username,
+		})
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		accessKey, err = createDynamicUser(ctx, client, role, username)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		// from here the lease revocation owns the user
+		if err := framework.DeleteWAL(ctx, req.Storage, walId); err != nil {
+			b.Logger().Warn("deleting dynamic user WAL entry", "username", username, "error", err)
+		}
+	} else {
+		accessKey, err = role.NewestKey()
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		accessKey.Leases++
+		if err := setRole(ctx, req.Storage, role); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		accessKey.UserName = role.Username
 	}
 	resp := b.Secret(secretAccessKeyType).Response(map[string]interface{}{
 		"secret_access_key": accessKey.SecretAccessKey,
 		"access_key_id":     accessKey.AccessKeyId,
 		"namespace":         role.Namespace,
-		"username":          role.Username,
+		"username":          accessKey.UserName,
 	}, map[string]interface{}{
 		"secret_access_key": accessKey.SecretAccessKey,
+		"access_key_id":     accessKey.AccessKeyId,
+		"role":              roleName,
+		"namespace":         role.Namespace,
+		"username":          accessKey.UserName,
+		"credential_type":   role.GetCredentialType(),
+		"user_type":         role.GetUserType(),
+		"connection":        role.Connection,
 	})
 
+	setLeaseDuration(resp, role)
+	return resp, nil
+}
+
+// objectUserCreds hands out the s3 secret key and or the swift password of the role object user
+func (b *backend) objectUserCreds(ctx context.Context, storage logical.Storage, roleName string, role *model.Role) (*logical.Response, error) {
+	data := map[string]interface{}{
+		"namespace": role.Namespace,
+		"username":  role.Username,
+	}
+	internalData := map[string]interface{}{
+		"role":            roleName,
+		"namespace":       role.Namespace,
+		"username":        role.Username,
+		"credential_type": role.GetCredentialType(),
+		"user_type":       role.GetUserType(),
+		"connection":      role.Connection,
+	}
+	if role.HasS3() {
+		accessKey, err := role.NewestKey()
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		data["access_key_id"] = accessKey.AccessKeyId
+		data["secret_access_key"] = accessKey.SecretAccessKey
+		internalData["access_key_id"] = accessKey.AccessKeyId
+		internalData["secret_access_key"] = accessKey.SecretAccessKey
+		accessKey.Leases++
+	}
+	if role.HasSwift() {
+		if role.SwiftPassword == "" {
+			// the revocation of its last lease deleted the previous password
+			ecs, err := b.getEcsClient(ctx, storage, role.Connection, "object users")
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			if err := ecs.rotateSwiftPassword(ctx, role); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+		role.SwiftLeases++
+		data["swift_password"] = role.SwiftPassword
+		data["swift_groups"] = role.SwiftGroups
+		internalData["swift_password"] = role.SwiftPassword
+	}
+	if err := setRole(ctx, storage, role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	resp := b.Secret(secretAccessKeyType).Response(data, internalData)
+	setLeaseDuration(resp, role)
+	return resp, nil
+}
+
+func setLeaseDuration(resp *logical.Response, role *model.Role) {
 	if role.TTL > 0 {
 		resp.Secret.TTL = role.TTL
 	}
-
 	if role.MaxTTL > 0 {
 		resp.Secret.MaxTTL = role.MaxTTL
 	}
-
-	return resp, nil
 }
 
 func (b *backend) secretAccessKey() *framework.Secret {
@@ -73,5 +194,224 @@ func (b *backend) secretAccessKey() *framework.Secret {
 				Type: framework.TypeString,
 			},
 		},
+		Renew:  b.secretAccessKeyRenew,
+		Revoke: b.secretAccessKeyRevoke,
+	}
+}
+
+func (b *backend) secretAccessKeyRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+	role, err := getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s not found", roleName)
+	}
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = role.TTL
+	resp.Secret.MaxTTL = role.MaxTTL
+	return resp, nil
+}
+
+// secretAccessKeyRevoke counts down the leases of the leased access key. The last one deletes the key on ECS,
+// and puts a new key in its place when creds still hand it out, so that revoking every lease cuts off access.
+func (b *backend) secretAccessKeyRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if userType, _ := req.Secret.InternalData["user_type"].(string); userType == model.UserTypeObjectUser {
+		return b.objectUserRevoke(ctx, req)
+	}
+	accessKeyId, ok := req.Secret.InternalData["access_key_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing access_key_id internal data")
+	}
+	namespace, _ := req.Secret.InternalData["namespace"].(string)
+	username, _ := req.Secret.InternalData["username"].(string)
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	// leases issued before connections existed have none, they belong to the default one
+	connection, _ := req.Secret.InternalData["connection"].(string)
+
+	client, err := b.getClient(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
 	}
+	if credentialType, _ := req.Secret.InternalData["credential_type"].(string); credentialType == model.CredentialTypeDynamicUser {
+		// the iam user only exists for this lease
+		return nil, client.deleteIamUserAndKeys(ctx, namespace, username)
+	}
+
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+	role, err := getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	var key *model.AccessKey
+	if role != nil {
+		role.Name = roleName
+		key = role.KeyById(accessKeyId)
+	}
+	if key == nil {
+		// the role or a safe revocation already dropped the key, make sure ECS did too
+		return nil, client.deleteAccessKey(ctx, namespace, username, accessKeyId)
+	}
+	if key.Leases > 1 {
+		key.Leases--
+		return nil, setRole(ctx, req.Storage, role)
+	}
+	if isCurrentKey(role, key) {
+		return nil, replaceAccessKey(ctx, req.Storage, client, role, accessKeyId)
+	}
+	if err := client.deleteAccessKey(ctx, namespace, username, accessKeyId); err != nil {
+		return nil, err
+	}
+	role.RemoveAccessKey(accessKeyId)
+	return nil, setRole(ctx, req.Storage, role)
+}
+
+// objectUserRevoke counts down the leases of the leased secret key and swift password of the object user,
+// the last lease of each deletes it
+func (b *backend) objectUserRevoke(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	namespace, _ := req.Secret.InternalData["namespace"].(string)
+	username, _ := req.Secret.InternalData["username"].(string)
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	connection, _ := req.Secret.InternalData["connection"].(string)
+	// object user keys all share the user name as id, the secret tells them apart
+	secret, _ := req.Secret.InternalData["secret_access_key"].(string)
+	swiftPassword, _ := req.Secret.InternalData["swift_password"].(string)
+
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+	role, err := getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := b.getEcsClient(ctx, req.Storage, connection, "object users")
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		if secret == "" {
+			return nil, nil
+		}
+		return nil, client.deleteSecretKey(ctx, namespace, username, secret)
+	}
+	role.Name = roleName
+	if secret != "" {
+		if err := revokeSecretKey(ctx, req.Storage, client, role, secret); err != nil {
+			return nil, err
+		}
+	}
+	// a rotation already replaced a swift password other than the role one
+	if swiftPassword == "" || swiftPassword != role.SwiftPassword {
+		return nil, nil
+	}
+	if role.SwiftLeases > 1 {
+		role.SwiftLeases--
+		return nil, setRole(ctx, req.Storage, role)
+	}
+	// the next creds read sets a new password
+	if err := client.deleteSwiftPassword(ctx, namespace, username); err != nil {
+		return nil, err
+	}
+	role.SwiftPassword = ""
+	role.SwiftLeases = 0
+	return nil, setRole(ctx, req.Storage, role)
+}
+
+// revokeSecretKey counts down the leases of the object user secret key. The last one deletes the key, and
+// creates a new one in its place when creds still hand it out.
+func revokeSecretKey(ctx context.Context, storage logical.Storage, client *ecsClient, role *model.Role, secret string) error {
+	key := role.KeyBySecret(secret)
+	if key == nil {
+		// a rotation or a safe revocation already dropped the key, make sure ECS did too
+		return client.deleteSecretKey(ctx, role.Namespace, role.Username, secret)
+	}
+	if key.Leases > 1 {
+		key.Leases--
+		return setRole(ctx, storage, role)
+	}
+	current := isCurrentKey(role, key)
+	if err := client.deleteSecretKey(ctx, role.Namespace, role.Username, secret); err != nil {
+		return err
+	}
+	role.RemoveSecretKey(secret)
+	if !current {
+		return setRole(ctx, storage, role)
+	}
+	newKey, err := client.createSecretKey(ctx, role.Namespace, role.Username, 0)
+	if err != nil {
+		// the deleted key must not be handed out again
+		if err := setRole(ctx, storage, role); err != nil {
+			blog.Warn("dropping deleted secret key from role", "role", role.Name, "error", err)
+		}
+		return err
+	}
+	role.AccessKeys = append(role.AccessKeys, newKey)
+	return saveRotatedRole(ctx, storage, role)
+}
+
+// isCurrentKey tells whether the key is the one creds hand out to new leases of the role
+func isCurrentKey(role *model.Role, key *model.AccessKey) bool {
+	newest, err := role.NewestKey()
+	return err == nil && newest == key
+}
+
+// assumedRoleCreds issues STS credentials of the role iam role, with a lease matching their lifetime
+func (b *backend) assumedRoleCreds(ctx context.Context, req *logical.Request, roleName string, role *model.Role) (*logical.Response, error) {
+	accessKey, err := role.NewestKey()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	duration := role.TTL
+	if duration <= 0 {
+		duration = defaultStsDuration
+	}
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	creds, err := client.assumeRole(ctx, accessKey, role.RoleArn, stsSessionName(roleName), duration)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	resp := b.Secret(secretAssumedRoleType).Response(map[string]interface{}{
+		"access_key_id":     creds.AccessKeyId,
+		"secret_access_key": creds.SecretAccessKey,
+		"session_token":     creds.SessionToken,
+		"expiration":        creds.Expiration,
+		"namespace":         role.Namespace,
+		"role_arn":          role.RoleArn,
+	}, map[string]interface{}{
+		"role": roleName,
+	})
+	// STS credentials cannot be extended, the lease ends with them
+	resp.Secret.TTL = duration
+	resp.Secret.MaxTTL = duration
+	return resp, nil
+}
+
+func (b *backend) secretAssumedRole() *framework.Secret {
+	return &framework.Secret{
+		Type: secretAssumedRoleType,
+		Fields: map[string]*framework.FieldSchema{
+			"access_key_id": {
+				Type: framework.TypeString,
+			},
+			"secret_access_key": {
+				Type: framework.TypeString,
+			},
+			"session_token": {
+				Type: framework.TypeString,
+			},
+		},
+		Revoke: b.secretAssumedRoleRevoke,
+	}
+}
+
+// secretAssumedRoleRevoke has nothing to do, STS credentials cannot be revoked and expire on their own
+func (b *backend) secretAssumedRoleRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, nil
 }
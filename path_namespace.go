@@ -0,0 +1,297 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"strings"
+	"time"
+)
+
+func pathNamespace(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "namespace/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the namespace",
+					Required:    true,
+				},
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS connection the namespace lives on, the one configured at config when empty.",
+				},
+				"replication_group": {
+					Type:        framework.TypeString,
+					Description: "Default replication group of the namespace buckets.",
+				},
+				"admins": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Management users administering the namespace.",
+				},
+				"quota_hard_gb": {
+					Type:        framework.TypeInt,
+					Description: "Size in GB above which writes to the namespace are blocked. 0 removes the quota.",
+				},
+				"quota_soft_gb": {
+					Type:        framework.TypeInt,
+					Description: "Size in GB above which ECS raises a notification. 0 removes the quota.",
+				},
+				"default_bucket_quota_gb": {
+					Type:        framework.TypeInt,
+					Description: "Hard quota in GB of the buckets created in the namespace. 0 means no quota.",
+				},
+				"retention_classes": {
+					Type:        framework.TypeKVPairs,
+					Description: "Retention classes of the namespace, as name=period pairs, periods like 3600, 72h or 30d.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathNamespaceRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathNamespaceWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathNamespaceUpdate,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathNamespaceDelete,
+				},
+			},
+			ExistenceCheck:  b.pathNamespaceExistenceCheck,
+			HelpSynopsis:    pathNamespaceHelpSynopsis,
+			HelpDescription: pathNamespaceHelpDescription,
+		},
+		{
+			Pattern: "namespace/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS connection, the one configured at config when empty.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathNamespacesList,
+				},
+			},
+		},
+	}
+}
+
+// pathNamespaceExistenceCheck asks ECS, namespaces are not stored in vault
+func (b *backend) pathNamespaceExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return false, err
+	}
+	namespace, err := client.getNamespace(ctx, d.Get("name").(string))
+	if err != nil {
+		return false, fmt.Errorf("existence check failed: %w", err)
+	}
+	return namespace != nil, nil
+}
+
+func (b *backend) pathNamespacesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	namespaces, err := client.listNamespaces(ctx)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	names := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		names = append(names, namespace.Name)
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathNamespaceWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	classes, err := retentionClasses(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	err = client.createNamespace(ctx, model.NamespaceCreate{
+		Namespace:              name,
+		DefaultVpool:           d.Get("replication_group").(string),
+		Admins:                 strings.Join(d.Get("admins").([]string), ","),
+		DefaultBucketBlockSize: int64(d.Get("default_bucket_quota_gb").(int)),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	// from here the namespace exists, a failure leaves it for an update to finish
+	hardGb, softGb := d.Get("quota_hard_gb").(int), d.Get("quota_soft_gb").(int)
+	if hardGb > 0 || softGb > 0 {
+		if err := client.setNamespaceQuota(ctx, name, int64(hardGb), int64(softGb)); err != nil {
+			return logical.ErrorResponse("namespace created but setting its quota failed: %s", err), nil
+		}
+	}
+	if len(classes) > 0 {
+		if err := client.setRetentionClasses(ctx, name, classes); err != nil {
+			return logical.ErrorResponse("namespace created but setting its retention classes failed: %s", err), nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *backend) pathNamespaceUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	classes, err := retentionClasses(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	namespace, err := client.getNamespace(ctx, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if namespace == nil {
+		return logical.ErrorResponse("namespace %s not found", name), nil
+	}
+	update := model.NamespaceUpdate{
+		DefaultVpool:           namespace.DefaultVpool,
+		Admins:                 namespace.Admins,
+		DefaultBucketBlockSize: namespace.DefaultBucketBlockSize,
+	}
+	if replicationGroup, ok := d.GetOk("replication_group"); ok {
+		update.DefaultVpool = replicationGroup.(string)
+	}
+	if admins, ok := d.GetOk("admins"); ok {
+		update.Admins = strings.Join(admins.([]string), ",")
+	}
+	if quotaGb, ok := d.GetOk("default_bucket_quota_gb"); ok {
+		update.DefaultBucketBlockSize = int64(quotaGb.(int))
+		if update.DefaultBucketBlockSize <= 0 {
+			update.DefaultBucketBlockSize = -1
+		}
+	}
+	if err := client.updateNamespace(ctx, name, update); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	hardGb, okHard := d.GetOk("quota_hard_gb")
+	softGb, okSoft := d.GetOk("quota_soft_gb")
+	if okHard || okSoft {
+		quota, err := client.getNamespaceQuota(ctx, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if !okHard {
+			hardGb = int(quota.BlockSize)
+		}
+		if !okSoft {
+			softGb = int(quota.NotificationSize)
+		}
+		if err := client.setNamespaceQuota(ctx, name, int64(hardGb.(int)), int64(softGb.(int))); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if len(classes) > 0 {
+		if err := client.setRetentionClasses(ctx, name, classes); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *backend) pathNamespaceRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	namespace, err := client.getNamespace(ctx, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if namespace == nil {
+		return logical.ErrorResponse("namespace not found"), nil
+	}
+	quota, err := client.getNamespaceQuota(ctx, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	classes, err := client.listRetentionClasses(ctx, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	retention := map[string]int64{}
+	for _, class := range classes {
+		retention[class.Name] = class.Period
+	}
+	admins := []string{}
+	if namespace.Admins != "" {
+		admins = strings.Split(namespace.Admins, ",")
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                    namespace.Name,
+			"replication_group":       namespace.DefaultVpool,
+			"admins":                  admins,
+			"quota_hard_gb":           positiveGb(quota.BlockSize),
+			"quota_soft_gb":           positiveGb(quota.NotificationSize),
+			"default_bucket_quota_gb": positiveGb(namespace.DefaultBucketBlockSize),
+			"retention_classes":       retention,
+		},
+	}, nil
+}
+
+// pathNamespaceDelete deletes the namespace on ECS, which refuses it while the namespace holds buckets
+func (b *backend) pathNamespaceDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	client, err := b.getEcsClient(ctx, req.Storage, connectionParam(d), "namespaces")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := client.deleteNamespace(ctx, d.Get("name").(string)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return nil, nil
+}
+
+func retentionClasses(d *framework.FieldData) (map[string]time.Duration, error) {
+	classes := map[string]time.Duration{}
+	for name, period := range d.Get("retention_classes").(map[string]string) {
+		duration, err := parseutil.ParseDurationSecond(period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period of retention class %s: %w", name, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("period of retention class %s must be positive", name)
+		}
+		classes[name] = duration
+	}
+	return classes, nil
+}
+
+// positiveGb reports the unset -1 sizes of ECS as 0
+func positiveGb(size int64) int64 {
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+const pathNamespaceHelpSynopsis = `Manages the ECS namespaces, at namespace/<name>.`
+
+const pathNamespaceHelpDescription = `
+Creates, reads, updates and deletes ECS namespaces through the management api, with their default
+replication group, admins, quotas, default bucket quota and retention classes.
+Retention classes are created or have their period updated, ECS cannot delete them so the ones
+not given are left in place. Deleting a namespace fails while it still holds buckets.
+`
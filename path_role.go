@@ -2,13 +2,21 @@ package os2
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/exp/slices"
 	"os2/model"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// ECS iam user names follow the AWS rules
+var iamUsernameRegex = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+
 func pathRole(b *backend) []*framework.Path {
 	return []*framework.Path{
 		{
@@ -23,13 +31,75 @@ func pathRole(b *backend) []*framework.Path {
 					Type:     framework.TypeLowerCaseString,
 					Required: true,
 				},
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS connection the role iam users live on, the one configured at config when empty.",
+				},
 				"safe_id": {
-					Type:     framework.TypeLowerCaseString,
-					Required: true,
+					Type:        framework.TypeLowerCaseString,
+					Description: "Identifier of the safe the role belongs to.",
+					Required:    true,
 				},
 				"username": {
-					Type:     framework.TypeLowerCaseString,
-					Required: true,
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the ECS user of the role, the name prefix of the users of dynamic_user roles. Derived from the part of the role name after the first underscore when empty.",
+					Required:    true,
+				},
+				"credential_type": {
+					Type:          framework.TypeLowerCaseString,
+					Description:   "static_keys to share the role iam user keys, dynamic_user to create an iam user per lease, assumed_role to issue STS credentials of role_arn.",
+					Default:       model.CredentialTypeStaticKeys,
+					AllowedValues: []interface{}{model.CredentialTypeStaticKeys, model.CredentialTypeDynamicUser, model.CredentialTypeAssumedRole},
+				},
+				"user_type": {
+					Type:          framework.TypeLowerCaseString,
+					Description:   "iam_user for roles backed by iam users, object_user for roles backed by legacy ECS object users and their secret keys.",
+					Default:       model.UserTypeIamUser,
+					AllowedValues: []interface{}{model.UserTypeIamUser, model.UserTypeObjectUser},
+				},
+				"existing_key_expiry_time_mins": {
+					Type:        framework.TypeInt,
+					Description: "Minutes the previous secret key of an object_user role stays valid after a rotation. 0 deletes it right away.",
+				},
+				"locked": {
+					Type:        framework.TypeBool,
+					Description: "Whether the object user of an object_user role is locked.",
+				},
+				"auth_types": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "APIs object_user roles issue credentials for: s3 secret keys, swift passwords or both. Defaults to s3.",
+				},
+				"swift_groups": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Swift groups of the object user of object_user roles issuing swift passwords.",
+				},
+				"role_arn": {
+					Type:        framework.TypeString,
+					Description: "IAM role assumed by assumed_role roles. The role iam user must be allowed to assume it.",
+				},
+				"policy_arns": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Managed policies attached to the iam user. Defaults to ECSS3FullAccess when no policy_document is given either, except for assumed_role roles.",
+				},
+				"policy_document": {
+					Type:        framework.TypeString,
+					Description: "JSON policy document put as inline policy on the iam user.",
+				},
+				"groups": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "IAM groups the iam user is a member of.",
+				},
+				"tags": {
+					Type:        framework.TypeKVPairs,
+					Description: "Tags set on the iam user, as key=value pairs.",
+				},
+				"rotation_period": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Period after which the oldest access key is rotated automatically. 0 disables scheduled rotation.",
+				},
+				"rotation_window": {
+					Type:        framework.TypeString,
+					Description: "Daily UTC time range, formatted HH:MM-HH:MM, in which scheduled rotations may run.",
 				},
 				"ttl": {
 					Type:        framework.TypeDurationSecond,
@@ -47,6 +117,9 @@ func pathRole(b *backend) []*framework.Path {
 				logical.CreateOperation: &framework.PathOperation{
 					Callback: b.pathRoleWrite,
 				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRoleUpdate,
+				},
 				logical.DeleteOperation: &framework.PathOperation{
 					Callback: b.pathRoleDelete,
 				},
@@ -55,6 +128,40 @@ func pathRole(b *backend) []*framework.Path {
 		},
 		{
 			Pattern: "role/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"after": {
+					Type:        framework.TypeString,
+					Description: "Only list the roles whose name sorts after this one.",
+				},
+				"limit": {
+					Type:        framework.TypeInt,
+					Description: "Maximum number of roles listed, 0 for all.",
+				},
+				"namespace": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Only list the roles of this namespace.",
+				},
+				"safe_id": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Only list the roles of this safe.",
+				},
+				"connection": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Only list the roles of this ECS connection.",
+				},
+				"min_key_age": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Only list the roles whose oldest access key is at least this old.",
+				},
+				"max_key_age": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Only list the roles whose oldest access key is at most this old.",
+				},
+				"key_info": {
+					Type:        framework.TypeBool,
+					Description: "Return the namespace, username, key count and oldest key age of the listed roles.",
+				},
+			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ListOperation: &framework.PathOperation{
 					Callback: b.pathRolesList,
@@ -64,13 +171,83 @@ func pathRole(b *backend) []*framework.Path {
 	}
 }
 
+// pathRolesList lists the roles in name order, roles are only read when filters or key info are requested
 func (b *backend) pathRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	roles, err := req.Storage.List(ctx, "role/")
+	var roles []string
+	var err error
+	if safeId := d.Get("safe_id").(string); safeId != "" {
+		roles, err = listSafeRoles(ctx, req.Storage, safeId)
+	} else {
+		roles, err = req.Storage.List(ctx, "role/")
+	}
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
+	sort.Strings(roles)
+	after, limit := d.Get("after").(string), d.Get("limit").(int)
+	if limit < 0 {
+		return logical.ErrorResponse("limit cannot be negative"), nil
+	}
+	namespace, namespaceOk := d.GetOk("namespace")
+	connection, connectionOk := d.GetOk("connection")
+	minKeyAge := time.Duration(d.Get("min_key_age").(int)) * time.Second
+	maxKeyAge := time.Duration(d.Get("max_key_age").(int)) * time.Second
+	keyInfo := d.Get("key_info").(bool)
+	readRoles := keyInfo || namespaceOk || connectionOk || minKeyAge > 0 || maxKeyAge > 0
 
-	return logical.ListResponse(roles), nil
+	now := time.Now().UTC()
+	keys := []string{}
+	infos := map[string]interface{}{}
+	for _, roleName := range roles {
+		if strings.HasSuffix(roleName, "/") || roleName <= after {
+			continue
+		}
+		if limit > 0 && len(keys) == limit {
+			break
+		}
+		if !readRoles {
+			keys = append(keys, roleName)
+			continue
+		}
+		role, err := getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role == nil {
+			continue
+		}
+		if namespaceOk && role.Namespace != namespace.(string) {
+			continue
+		}
+		if connectionOk && role.GetConnection() != connection.(string) {
+			continue
+		}
+		keyAge, hasKey := role.OldestKeyAge(now)
+		if (minKeyAge > 0 || maxKeyAge > 0) && !hasKey {
+			continue
+		}
+		if (minKeyAge > 0 && keyAge < minKeyAge) || (maxKeyAge > 0 && keyAge > maxKeyAge) {
+			continue
+		}
+		keys = append(keys, roleName)
+		if keyInfo {
+			info := map[string]interface{}{
+				"namespace":  role.Namespace,
+				"username":   role.Username,
+				"safe_id":    role.SafeId,
+				"connection": role.GetConnection(),
+				"key_count":  len(role.AccessKeys),
+			}
+			if hasKey {
+				info["oldest_key_age"] = int64(keyAge.Seconds())
+			}
+			infos[roleName] = info
+		}
+	}
+	if keyInfo {
+		return logical.ListResponseWithInfo(keys, infos), nil
+	}
+	return logical.ListResponse(keys), nil
 }
 
 func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -86,23 +263,78 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 	if entry != nil {
 		return logical.ErrorResponse("role already exists"), nil
 	}
-	_, username, _ := strings.Cut(roleName, "_")
-	client, err := b.getClient(ctx, req.Storage)
+	credentialType := d.Get("credential_type").(string)
+	if credentialType != model.CredentialTypeStaticKeys && credentialType != model.CredentialTypeDynamicUser && credentialType != model.CredentialTypeAssumedRole {
+		return logical.ErrorResponse("unknown credential_type %s", credentialType), nil
+	}
+	userType := d.Get("user_type").(string)
+	if userType != model.UserTypeIamUser && userType != model.UserTypeObjectUser {
+		return logical.ErrorResponse("unknown user_type %s", userType), nil
+	}
+	username, err := roleUsername(roleName, d)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
-
 	}
-
-	role, err := client.createIamUser(namespace.(string), username)
+	role := &model.Role{
+		Name:           roleName,
+		Username:       username,
+		Namespace:      namespace.(string),
+		Connection:     connectionParam(d),
+		CredentialType: credentialType,
+		UserType:       userType,
+		AuthTypes:      d.Get("auth_types").([]string),
+	}
+	if err := validateAuthTypes(role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := updateRoleFields(role, d); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 
 	}
-	role.Name = roleName
-	debug(role)
+
+	var walId string
+	if role.IsDynamic() {
+		// iam users are created on each creds read, only check the namespace here
+		found, err := client.checkNsExists(ctx, role.Namespace)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if !found {
+			return logical.ErrorResponse("namespace %s not found", role.Namespace), nil
+		}
+	} else {
+		walId, err = b.putRoleCreateWAL(ctx, req.Storage, client, role)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		// on failure the WAL entry is left for the rollback to clean up ECS
+		if role.IsObjectUser() {
+			var ecs *ecsClient
+			if ecs, err = ecsOnly(client, "object users"); err == nil {
+				err = ecs.createObjectUser(ctx, role)
+			}
+		} else {
+			err = createIamUser(ctx, client, role)
+		}
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
 	if err := setRole(ctx, req.Storage, role); err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
+	if err := setSafeIndex(ctx, req.Storage, roleName, "", role.SafeId); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if walId != "" {
+		if err := framework.DeleteWAL(ctx, req.Storage, walId); err != nil {
+			b.Logger().Warn("deleting role create WAL entry", "role", roleName, "error", err)
+		}
+	}
 	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"role_name": roleName,
@@ -110,6 +342,191 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 	return resp, nil
 }
 
+// pathRoleUpdate saves the given fields on an existing role and reconciles its iam user on ECS
+func (b *backend) pathRoleUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	roleName := d.Get("name").(string)
+	role, err := getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role == nil {
+		return logical.ErrorResponse("role not found"), nil
+	}
+	role.Name = roleName
+	if namespace, ok := d.GetOk("namespace"); ok && namespace.(string) != role.Namespace {
+		return logical.ErrorResponse("namespace of role %s cannot be changed", roleName), nil
+	}
+	if _, ok := d.GetOk("connection"); ok && connectionParam(d) != role.Connection {
+		return logical.ErrorResponse("connection of role %s cannot be changed", roleName), nil
+	}
+	if credentialType, ok := d.GetOk("credential_type"); ok && credentialType.(string) != role.GetCredentialType() {
+		return logical.ErrorResponse("credential_type of role %s cannot be changed", roleName), nil
+	}
+	if username, ok := d.GetOk("username"); ok && username.(string) != role.Username {
+		return logical.ErrorResponse("username of role %s cannot be changed", roleName), nil
+	}
+	if userType, ok := d.GetOk("user_type"); ok && userType.(string) != role.GetUserType() {
+		return logical.ErrorResponse("user_type of role %s cannot be changed", roleName), nil
+	}
+	if authTypes, ok := d.GetOk("auth_types"); ok && !slices.Equal(authTypes.([]string), role.GetAuthTypes()) {
+		return logical.ErrorResponse("auth_types of role %s cannot be changed", roleName), nil
+	}
+	wasLocked := role.Locked
+	swiftGroups := role.SwiftGroups
+	safeId := role.SafeId
+	if err := updateRoleFields(role, d); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	changes := []string{}
+	if role.IsObjectUser() {
+		// object users have no policies, groups or tags, only their lock state and swift groups are reconciled
+		client, err := b.getEcsClient(ctx, req.Storage, role.Connection, "object users")
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role.HasSwift() && !slices.Equal(role.SwiftGroups, swiftGroups) {
+			if role.SwiftPassword == "" {
+				err = client.rotateSwiftPassword(ctx, role)
+			} else {
+				err = client.setSwiftPassword(ctx, role.Namespace, role.Username, role.SwiftPassword, role.SwiftGroups)
+			}
+			if err != nil {
+				return logical.ErrorResponse("setting swift groups of object user %s: %s", role.Username, err), nil
+			}
+			changes = append(changes, "set swift groups of object user "+role.Username)
+		}
+		if role.Locked != wasLocked {
+			if err := client.lockObjectUser(ctx, role.Namespace, role.Username, role.Locked); err != nil {
+				return logical.ErrorResponse("locking object user %s: %s", role.Username, err), nil
+			}
+			if role.Locked {
+				changes = append(changes, "locked object user "+role.Username)
+			} else {
+				changes = append(changes, "unlocked object user "+role.Username)
+			}
+		}
+	} else if !role.IsDynamic() {
+		// users of dynamic roles pick up the changes on their next creds read
+		client, err := b.getClient(ctx, req.Storage, role.Connection)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		applied, err := client.reconcileIamUser(ctx, role.Namespace, role.Username, role)
+		changes = append(changes, applied...)
+		if err != nil {
+			resp := logical.ErrorResponse("reconciling user %s: %s", role.Username, err)
+			resp.Data["changes"] = changes
+			return resp, nil
+		}
+	}
+	if err := setRole(ctx, req.Storage, role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := setSafeIndex(ctx, req.Storage, roleName, safeId, role.SafeId); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	respData := role.ToResponseData()
+	respData["changes"] = changes
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// updateRoleFields sets the mutable role fields present in the request
+func updateRoleFields(role *model.Role, d *framework.FieldData) error {
+	if safeId, ok := d.GetOk("safe_id"); ok {
+		role.SafeId = safeId.(string)
+	}
+	if ttl, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return fmt.Errorf("ttl cannot be greater than max_ttl")
+	}
+	if policyArns, ok := d.GetOk("policy_arns"); ok {
+		role.PolicyArns = policyArns.([]string)
+	}
+	if policyDocument, ok := d.GetOk("policy_document"); ok {
+		role.PolicyDocument = policyDocument.(string)
+	}
+	if err := validatePolicies(role.PolicyArns, role.PolicyDocument); err != nil {
+		return err
+	}
+	if roleArn, ok := d.GetOk("role_arn"); ok {
+		role.RoleArn = roleArn.(string)
+	}
+	if role.IsAssumedRole() {
+		if !strings.HasPrefix(role.RoleArn, "urn:ecs:iam:") && !strings.HasPrefix(role.RoleArn, "arn:aws:iam:") {
+			return fmt.Errorf("assumed_role roles require a role_arn such as urn:ecs:iam::<namespace>:role/<name>, or arn:aws:iam::<tenant>:role/<name> on ceph_rgw")
+		}
+		if role.TTL > 0 && (role.TTL < minStsDuration || role.TTL > maxStsDuration) {
+			return fmt.Errorf("ttl of assumed_role roles must be between %s and %s", minStsDuration, maxStsDuration)
+		}
+	}
+	if groups, ok := d.GetOk("groups"); ok {
+		role.Groups = groups.([]string)
+	}
+	if tags, ok := d.GetOk("tags"); ok {
+		role.Tags = tags.(map[string]string)
+	}
+	if expiryMins, ok := d.GetOk("existing_key_expiry_time_mins"); ok {
+		if !role.IsObjectUser() {
+			return fmt.Errorf("existing_key_expiry_time_mins only applies to object_user roles")
+		}
+		if expiryMins.(int) < 0 {
+			return fmt.Errorf("existing_key_expiry_time_mins cannot be negative")
+		}
+		role.ExistingKeyExpiryMins = expiryMins.(int)
+	}
+	if locked, ok := d.GetOk("locked"); ok {
+		if !role.IsObjectUser() {
+			return fmt.Errorf("locked only applies to object_user roles")
+		}
+		role.Locked = locked.(bool)
+	}
+	if swiftGroups, ok := d.GetOk("swift_groups"); ok {
+		if !role.HasSwift() {
+			return fmt.Errorf("swift_groups only applies to object_user roles issuing swift passwords")
+		}
+		role.SwiftGroups = swiftGroups.([]string)
+	}
+	if role.IsObjectUser() {
+		if role.GetCredentialType() != model.CredentialTypeStaticKeys {
+			return fmt.Errorf("object_user roles only support the static_keys credential_type")
+		}
+		if len(role.PolicyArns) > 0 || role.PolicyDocument != "" || len(role.Groups) > 0 || len(role.Tags) > 0 {
+			return fmt.Errorf("object users have no iam policies, groups or tags")
+		}
+	}
+	if rotationWindow, ok := d.GetOk("rotation_window"); ok {
+		if rotationWindow.(string) != "" {
+			if _, _, err := model.ParseRotationWindow(rotationWindow.(string)); err != nil {
+				return err
+			}
+		}
+		role.RotationWindow = rotationWindow.(string)
+	}
+	if rotationPeriod, ok := d.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+		if role.RotationPeriod < 0 {
+			return fmt.Errorf("rotation_period cannot be negative")
+		}
+		from := role.LastRotated
+		if from.IsZero() {
+			from = time.Now().UTC()
+		}
+		role.ScheduleNextRotation(from)
+	}
+	return nil
+}
+
 func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	entry, err := getRole(ctx, req.Storage, d.Get("name").(string))
 	if err != nil {
@@ -127,24 +544,102 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, d *fra
 
 // pathRoleDelete makes a request to Vault storage to delete a role
 func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	roleName := data.Get("name").(string)
-	role, err := getRole(ctx, req.Storage, roleName)
+	warning, err := b.deleteRole(ctx, req.Storage, data.Get("name").(string))
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
-	err = req.Storage.Delete(ctx, "role/"+roleName)
+	if warning != "" {
+		resp := &logical.Response{}
+		resp.AddWarning(warning)
+		return resp, nil
+	}
+	return nil, nil
+}
+
+// deleteRole removes the role from storage and deletes its user on ECS, a failed user deletion is
+// returned as a warning since the WAL rollback retries it
+func (b *backend) deleteRole(ctx context.Context, storage logical.Storage, roleName string) (string, error) {
+	role, err := getRole(ctx, storage, roleName)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return "", err
+	}
+	if role == nil || role.IsDynamic() {
+		// dynamic users are deleted when their lease is revoked
+		if err := storage.Delete(ctx, "role/"+roleName); err != nil {
+			return "", err
+		}
+		if role != nil {
+			return "", setSafeIndex(ctx, storage, roleName, role.SafeId, "")
+		}
+		return "", nil
 	}
-	client, err := b.getClient(ctx, req.Storage)
+	walId, err := framework.PutWAL(ctx, storage, walRoleDeleteKind, &walIamUser{
+		RoleName:   roleName,
+		Namespace:  role.Namespace,
+		Connection: role.Connection,
+		Username:   role.Username,
+		UserType:   role.UserType,
+	})
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return "", err
+	}
+	if err := storage.Delete(ctx, "role/"+roleName); err != nil {
+		return "", err
+	}
+	if err := setSafeIndex(ctx, storage, roleName, role.SafeId, ""); err != nil {
+		return "", err
+	}
+	client, err := b.getClient(ctx, storage, role.Connection)
+	if err != nil {
+		return "", err
+	}
+	if err := client.deleteUser(ctx, role.UserType, role.Namespace, role.Username); err != nil {
+		return fmt.Sprintf("role deleted but deleting user %s failed, it will be retried: %s", role.Username, err), nil
+	}
+	if err := framework.DeleteWAL(ctx, storage, walId); err != nil {
+		b.Logger().Warn("deleting role delete WAL entry", "role", roleName, "error", err)
+	}
+	return "", nil
+}
 
+// roleUsername is the username field, or for clients predating it the part of the role name after the first underscore
+func roleUsername(roleName string, d *framework.FieldData) (string, error) {
+	username := d.Get("username").(string)
+	if username == "" {
+		_, username, _ = strings.Cut(roleName, "_")
 	}
-	if err := client.deleteIamUser(role.Namespace, role.Username); err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	if username == "" {
+		return "", fmt.Errorf("username is required, role name %s has no underscore to derive it from", roleName)
 	}
-	return nil, nil
+	if !iamUsernameRegex.MatchString(username) {
+		return "", fmt.Errorf("username %s must be 1 to %d letters, digits or +=,.@_- characters", username, maxIamUsernameLength)
+	}
+	return username, nil
+}
+
+// validateAuthTypes only lets object users issue swift passwords
+func validateAuthTypes(role *model.Role) error {
+	for _, authType := range role.AuthTypes {
+		if authType != model.AuthTypeS3 && authType != model.AuthTypeSwift {
+			return fmt.Errorf("unknown auth type %s", authType)
+		}
+		if authType == model.AuthTypeSwift && !role.IsObjectUser() {
+			return fmt.Errorf("swift auth type only applies to object_user roles")
+		}
+	}
+	return nil
+}
+
+func validatePolicies(policyArns []string, policyDocument string) error {
+	for _, policyArn := range policyArns {
+		if !strings.HasPrefix(policyArn, "urn:ecs:iam:") {
+			return fmt.Errorf("invalid policy arn %s", policyArn)
+		}
+	}
+	if policyDocument != "" && !json.Valid([]byte(policyDocument)) {
+		return fmt.Errorf("policy_document is not valid JSON")
+	}
+	return nil
 }
 
 func getRole(ctx context.Context, s logical.Storage, name string) (*model.Role, error) {
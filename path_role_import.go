@@ -0,0 +1,185 @@
+package os2
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"time"
+)
+
+func pathRoleImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role",
+				Required:    true,
+			},
+			"namespace": {
+				Type:     framework.TypeLowerCaseString,
+				Required: true,
+			},
+			"safe_id": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Identifier of the safe the role belongs to.",
+			},
+			"username": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the existing iam user. Derived from the part of the role name after the first underscore when empty.",
+			},
+			"connection": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the ECS connection the iam user lives on, the one configured at config when empty.",
+			},
+			"access_key_secrets": {
+				Type:        framework.TypeKVPairs,
+				Description: "Secrets of the existing access keys to adopt, as access_key_id=secret_access_key pairs.",
+			},
+			"rotate": {
+				Type:        framework.TypeBool,
+				Description: "Create a vault owned access key. When the user already has 2 keys, the oldest key with no given secret is deleted first.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRoleImportWrite,
+			},
+		},
+		HelpSynopsis:    pathRoleImportHelpSynopsis,
+		HelpDescription: pathRoleImportHelpDescription,
+	}
+}
+
+// pathRoleImportWrite creates a static keys role on top of an existing iam user, keeping its keys, policies, groups and tags
+func (b *backend) pathRoleImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get("name").(string)
+	namespace, okNs := d.GetOk("namespace")
+	if !okNs {
+		return logical.ErrorResponse("namespace is required"), nil
+	}
+	entry, err := getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if entry != nil {
+		return logical.ErrorResponse("role already exists"), nil
+	}
+	username, err := roleUsername(roleName, d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	role := &model.Role{
+		Name:           roleName,
+		Username:       username,
+		SafeId:         d.Get("safe_id").(string),
+		Namespace:      namespace.(string),
+		Connection:     connectionParam(d),
+		CredentialType: model.CredentialTypeStaticKeys,
+	}
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	found, err := client.checkIamUserExists(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if !found {
+		return logical.ErrorResponse("user %s not found in namespace %s", role.Username, role.Namespace), nil
+	}
+	keys, err := client.listAccessKeys(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	secrets := d.Get("access_key_secrets").(map[string]string)
+	for accessKeyId := range secrets {
+		if !containsKey(keys, accessKeyId) {
+			return logical.ErrorResponse("access key %s does not belong to user %s", accessKeyId, role.Username), nil
+		}
+	}
+	for i := range keys {
+		key := keys[i]
+		key.Imported = true
+		key.SecretAccessKey = secrets[key.AccessKeyId]
+		role.AccessKeys = append(role.AccessKeys, &key)
+	}
+	if err := client.describeIamUser(ctx, role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var walId string
+	if d.Get("rotate").(bool) {
+		walId, err = b.putRoleCreateWAL(ctx, req.Storage, client, role)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		deleteKeyId, err := keyToReplace(role)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if deleteKeyId != "" {
+			if err := client.deleteAccessKey(ctx, role.Namespace, role.Username, deleteKeyId); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+		key, err := client.createAccessKey(ctx, role.Namespace, role.Username)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		role.SetAccessKey(deleteKeyId, key)
+		role.LastRotated = time.Now().UTC()
+	}
+	if _, err := role.NewestKey(); err != nil {
+		return logical.ErrorResponse("no usable access key, give the secret of an existing key or set rotate"), nil
+	}
+	if err := setRole(ctx, req.Storage, role); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := setSafeIndex(ctx, req.Storage, roleName, "", role.SafeId); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if walId != "" {
+		if err := framework.DeleteWAL(ctx, req.Storage, walId); err != nil {
+			b.Logger().Warn("deleting role import WAL entry", "role", roleName, "error", err)
+		}
+	}
+	return &logical.Response{
+		Data: role.ToResponseData(),
+	}, nil
+}
+
+// keyToReplace picks the key deleted to make room for a vault owned one: none when the user has a free slot,
+// else the oldest key with no known secret, else the oldest key
+func keyToReplace(role *model.Role) (string, error) {
+	if len(role.AccessKeys) < 2 {
+		return "", nil
+	}
+	first, second := role.AccessKeys[0], role.AccessKeys[1]
+	if first.SecretAccessKey == "" && second.SecretAccessKey != "" {
+		return first.AccessKeyId, nil
+	}
+	if second.SecretAccessKey == "" && first.SecretAccessKey != "" {
+		return second.AccessKeyId, nil
+	}
+	return role.OldestKeyId()
+}
+
+func containsKey(keys []model.AccessKey, accessKeyId string) bool {
+	for _, key := range keys {
+		if key.AccessKeyId == accessKeyId {
+			return true
+		}
+	}
+	return false
+}
+
+const pathRoleImportHelpSynopsis = `Create a role from an existing ECS iam user.`
+
+const pathRoleImportHelpDescription = `
+The iam user keeps its access keys, policies, groups and tags.
+Give the secret of the keys vault may hand out in access_key_secrets,
+and/or set rotate to have vault create a key of its own.
+Keys with no known secret are never handed out and are replaced first on rotation.
+`
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"time"
 )
 
 func pathRotateRole(b *backend) *framework.Path {
@@ -38,30 +40,96 @@ func (b *backend) pathRotateRoleRead(ctx context.Context, req *logical.Request,
 	if role == nil {
 		return nil, fmt.Errorf("role not found")
 	}
-	role.Name = roleName
-	oldestKeyId, err := role.OldestKeyId()
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	if role.IsDynamic() {
+		return logical.ErrorResponse("role %s issues dynamic users, there is no key to rotate", roleName), nil
 	}
-	client, err := b.getClient(ctx, req.Storage)
+	role, err = b.rotateRoleKey(ctx, req.Storage, roleName)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
+	}
+	return &logical.Response{
+		Data: role.ToResponseData(),
+	}, nil
+}
 
+// rotateRoleKey replaces the oldest access key of the role with a new one
+func (b *backend) rotateRoleKey(ctx context.Context, storage logical.Storage, roleName string) (*model.Role, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	role, err := getRole(ctx, storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s not found", roleName)
 	}
-	if oldestKeyId != "" {
-		if err := client.deleteAccessKey(role.Namespace, role.Username, oldestKeyId); err != nil {
-			return logical.ErrorResponse(err.Error()), nil
+	role.Name = roleName
+	client, err := b.getClient(ctx, storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsObjectUser() {
+		ecs, err := ecsOnly(client, "object users")
+		if err != nil {
+			return nil, err
+		}
+		if role.HasS3() {
+			// ECS keeps the previous secret key valid for the grace window
+			keys, err := ecs.rotateSecretKey(ctx, role.Namespace, role.Username, role.ExistingKeyExpiryMins)
+			if err != nil {
+				return nil, err
+			}
+			previous := role.AccessKeys
+			role.AccessKeys = keys
+			role.KeepLeases(previous)
 		}
+		if role.HasSwift() {
+			if err := ecs.rotateSwiftPassword(ctx, role); err != nil {
+				return nil, err
+			}
+		}
+		if err := saveRotatedRole(ctx, storage, role); err != nil {
+			return nil, err
+		}
+		return role, nil
 	}
-	key, err := client.createAccessKey(role.Namespace, role.Username)
+	// an imported key without known secret goes first, it is not the one creds hand out
+	deleteKeyId, err := keyToReplace(role)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
-	role.SetAccessKey(oldestKeyId, key)
-	if err := setRole(ctx, req.Storage, role); err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	if err := replaceAccessKey(ctx, storage, client, role, deleteKeyId); err != nil {
+		return nil, err
 	}
-	return &logical.Response{
-		Data: role.ToResponseData(),
-	}, nil
+	return role, nil
+}
+
+// replaceAccessKey deletes the given key, if any, to make room for a new one. Iam users hold 2 keys at most so
+// the deletion comes first, and a deleted key leaves the stored role even when the creation fails, so that
+// creds never hand out a dead key.
+func replaceAccessKey(ctx context.Context, storage logical.Storage, client ObjectStoreProvider, role *model.Role, deleteKeyId string) error {
+	if deleteKeyId != "" {
+		if err := client.deleteAccessKey(ctx, role.Namespace, role.Username, deleteKeyId); err != nil {
+			return err
+		}
+	}
+	key, err := client.createAccessKey(ctx, role.Namespace, role.Username)
+	if err != nil {
+		if deleteKeyId != "" && role.RemoveAccessKey(deleteKeyId) {
+			if err := setRole(ctx, storage, role); err != nil {
+				blog.Warn("dropping deleted access key from role", "role", role.Name, "error", err)
+			}
+		}
+		return err
+	}
+	role.SetAccessKey(deleteKeyId, key)
+	return saveRotatedRole(ctx, storage, role)
+}
+
+func saveRotatedRole(ctx context.Context, storage logical.Storage, role *model.Role) error {
+	now := time.Now().UTC()
+	role.LastRotated = now
+	role.ScheduleNextRotation(now)
+	return setRole(ctx, storage, role)
 }
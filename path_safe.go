@@ -0,0 +1,277 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"strings"
+)
+
+// safeStoragePrefix holds the secondary index of roles by safe_id, as safe/<safe_id>/<role> entries
+const safeStoragePrefix = "safe/"
+
+func pathSafe(b *backend) []*framework.Path {
+	safeIdField := map[string]*framework.FieldSchema{
+		"safe_id": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "Identifier of the safe",
+			Required:    true,
+		},
+	}
+	return []*framework.Path{
+		{
+			Pattern: "safe/" + framework.GenericNameRegex("safe_id") + "/roles/?$",
+			Fields:  safeIdField,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathSafeRolesList,
+				},
+			},
+			HelpSynopsis: "Lists the roles of the safe.",
+		},
+		{
+			Pattern: "safe/" + framework.GenericNameRegex("safe_id") + "/rotate",
+			Fields:  safeIdField,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathSafeRotate,
+				},
+			},
+			HelpSynopsis: "Rotates the keys of every role of the safe, dynamic_user roles have none and are skipped.",
+		},
+		{
+			Pattern: "safe/" + framework.GenericNameRegex("safe_id") + "/revoke",
+			Fields:  safeIdField,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathSafeRevoke,
+				},
+			},
+			HelpSynopsis:    "Invalidates on ECS every credential issued for the roles of the safe.",
+			HelpDescription: pathSafeRevokeHelpDescription,
+		},
+		{
+			Pattern: "safe/" + framework.GenericNameRegex("safe_id"),
+			Fields:  safeIdField,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathSafeDelete,
+				},
+			},
+			HelpSynopsis: "Deletes every role of the safe, with their ECS users.",
+		},
+		{
+			Pattern: "safe/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathSafesList,
+				},
+			},
+		},
+	}
+}
+
+func (b *backend) pathSafesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	safes, err := req.Storage.List(ctx, safeStoragePrefix)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for i := range safes {
+		safes[i] = strings.TrimSuffix(safes[i], "/")
+	}
+	return logical.ListResponse(safes), nil
+}
+
+func (b *backend) pathSafeRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := listSafeRoles(ctx, req.Storage, d.Get("safe_id").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathSafeRotate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.forEachSafeRole(ctx, req.Storage, d.Get("safe_id").(string), func(roleName string, role *model.Role) (string, error) {
+		if role.IsDynamic() {
+			return "skipped, dynamic users have no key to rotate", nil
+		}
+		if _, err := b.rotateRoleKey(ctx, req.Storage, roleName); err != nil {
+			return "", err
+		}
+		return "rotated", nil
+	})
+}
+
+// pathSafeRevoke invalidates the credentials on ECS, the plugin cannot revoke vault leases itself so the
+// lease prefixes to revoke are returned
+func (b *backend) pathSafeRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var prefixes []string
+	resp, err := b.forEachSafeRole(ctx, req.Storage, d.Get("safe_id").(string), func(roleName string, role *model.Role) (string, error) {
+		// the trailing slash keeps vault lease revoke -prefix off the leases of roles such as <role>2
+		prefixes = append(prefixes, req.MountPoint+"creds/"+roleName+"/")
+		return b.revokeRoleCredentials(ctx, req.Storage, roleName)
+	})
+	if resp != nil && !resp.IsError() {
+		resp.Data["lease_prefixes"] = prefixes
+	}
+	return resp, err
+}
+
+func (b *backend) pathSafeDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.forEachSafeRole(ctx, req.Storage, d.Get("safe_id").(string), func(roleName string, role *model.Role) (string, error) {
+		warning, err := b.deleteRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return "", err
+		}
+		if warning != "" {
+			return warning, nil
+		}
+		return "deleted", nil
+	})
+}
+
+// forEachSafeRole applies the operation to every role of the safe, carrying on after failures, and reports
+// the outcome per role
+func (b *backend) forEachSafeRole(ctx context.Context, storage logical.Storage, safeId string, operation func(string, *model.Role) (string, error)) (*logical.Response, error) {
+	roleNames, err := listSafeRoles(ctx, storage, safeId)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if len(roleNames) == 0 {
+		return logical.ErrorResponse("safe %s has no role", safeId), nil
+	}
+	results := map[string]string{}
+	resp := &logical.Response{Data: map[string]interface{}{}}
+	for _, roleName := range roleNames {
+		role, err := getRole(ctx, storage, roleName)
+		if err == nil && role == nil {
+			// stale index entry of a role deleted in between
+			results[roleName] = "not found"
+			err = setSafeIndex(ctx, storage, roleName, safeId, "")
+		} else if err == nil {
+			results[roleName], err = operation(roleName, role)
+		}
+		if err != nil {
+			results[roleName] = "failed: " + err.Error()
+			resp.AddWarning(fmt.Sprintf("role %s: %s", roleName, err))
+		}
+	}
+	resp.Data["roles"] = results
+	return resp, nil
+}
+
+// revokeRoleCredentials deletes on ECS every credential handed out for the role and replaces them
+// with a fresh one, leases revoked afterwards find their credentials already gone
+func (b *backend) revokeRoleCredentials(ctx context.Context, storage logical.Storage, roleName string) (string, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	role, err := getRole(ctx, storage, roleName)
+	if err != nil {
+		return "", err
+	}
+	if role == nil {
+		return "", fmt.Errorf("role %s not found", roleName)
+	}
+	role.Name = roleName
+	if role.IsAssumedRole() {
+		return "skipped, STS credentials cannot be revoked and expire on their own", nil
+	}
+	client, err := b.getClient(ctx, storage, role.Connection)
+	if err != nil {
+		return "", err
+	}
+	if role.IsDynamic() {
+		users, err := client.getIamUsers(ctx, role.Namespace)
+		if err != nil {
+			return "", err
+		}
+		deleted := 0
+		for _, user := range users {
+			if isDynamicUsername(role.Username, user.UserName) {
+				if err := client.deleteIamUserAndKeys(ctx, role.Namespace, user.UserName); err != nil {
+					return "", err
+				}
+				deleted++
+			}
+		}
+		return fmt.Sprintf("deleted %d dynamic users", deleted), nil
+	}
+	if role.IsObjectUser() {
+		ecs, err := ecsOnly(client, "object users")
+		if err != nil {
+			return "", err
+		}
+		if role.HasS3() {
+			// an adopted user keeps the key it had, vault only hands out the role keys
+			for _, key := range role.AccessKeys {
+				if err := ecs.deleteSecretKey(ctx, role.Namespace, role.Username, key.SecretAccessKey); err != nil {
+					return "", err
+				}
+			}
+			key, err := ecs.createSecretKey(ctx, role.Namespace, role.Username, 0)
+			if err != nil {
+				return "", err
+			}
+			role.AccessKeys = []*model.AccessKey{key}
+		}
+		if role.HasSwift() {
+			if err := ecs.rotateSwiftPassword(ctx, role); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		// imported keys with no secret were never handed out, they stay
+		var kept []*model.AccessKey
+		for _, key := range role.AccessKeys {
+			if key.SecretAccessKey == "" {
+				kept = append(kept, key)
+				continue
+			}
+			if err := client.deleteAccessKey(ctx, role.Namespace, role.Username, key.AccessKeyId); err != nil {
+				return "", err
+			}
+		}
+		key, err := client.createAccessKey(ctx, role.Namespace, role.Username)
+		if err != nil {
+			return "", err
+		}
+		role.AccessKeys = append(kept, key)
+	}
+	if err := saveRotatedRole(ctx, storage, role); err != nil {
+		return "", err
+	}
+	return "revoked", nil
+}
+
+func listSafeRoles(ctx context.Context, storage logical.Storage, safeId string) ([]string, error) {
+	if safeId == "" {
+		return nil, fmt.Errorf("missing safe_id")
+	}
+	return storage.List(ctx, safeStoragePrefix+safeId+"/")
+}
+
+// setSafeIndex moves the role from the index of its old safe to the one of its new safe, empty for none
+func setSafeIndex(ctx context.Context, storage logical.Storage, roleName, oldSafeId, newSafeId string) error {
+	if oldSafeId == newSafeId {
+		return nil
+	}
+	if oldSafeId != "" {
+		if err := storage.Delete(ctx, safeStoragePrefix+oldSafeId+"/"+roleName); err != nil {
+			return err
+		}
+	}
+	if newSafeId != "" {
+		return storage.Put(ctx, &logical.StorageEntry{Key: safeStoragePrefix + newSafeId + "/" + roleName, Value: []byte(roleName)})
+	}
+	return nil
+}
+
+const pathSafeRevokeHelpDescription = `
+Deletes on ECS the keys handed out for the static roles of the safe and gives them a new one, deletes the
+users of their dynamic_user roles, and sets a new swift password on their object users. STS credentials of
+assumed_role roles cannot be revoked. Vault leases cannot be revoked by the plugin, the response lists the
+lease prefixes to revoke with vault lease revoke -prefix.
+`
@@ -0,0 +1,137 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"os2/model"
+	"time"
+)
+
+// ObjectStoreProvider is the admin API of an object store: its iam users, their access keys and policies,
+// and the namespaces they live in. ECS is the reference provider, the features only ECS has
+// (object users, buckets, namespace management, management password rotation) go through ecsOnly.
+type ObjectStoreProvider interface {
+	// providerType is the config provider value of the implementation
+	providerType() string
+
+	checkNsExists(ctx context.Context, namespace string) (bool, error)
+	checkIamUserExists(ctx context.Context, namespace, username string) (bool, error)
+	getIamUsers(ctx context.Context, namespace string) ([]model.IamUser, error)
+	// checkRoleSupported rejects the role settings the provider users cannot have
+	checkRoleSupported(role *model.Role) error
+	// createIamUserAndKey creates the user with the role settings and its first access key
+	createIamUserAndKey(ctx context.Context, namespace, username string, role *model.Role) (*model.AccessKey, error)
+	describeIamUser(ctx context.Context, role *model.Role) error
+	reconcileIamUser(ctx context.Context, namespace, username string, role *model.Role) ([]string, error)
+	deleteIamUserAndKeys(ctx context.Context, namespace, username string) error
+	// deleteUser deletes the user of the given role user type
+	deleteUser(ctx context.Context, userType, namespace, username string) error
+
+	createAccessKey(ctx context.Context, namespace, username string) (*model.AccessKey, error)
+	listAccessKeys(ctx context.Context, namespace, username string) ([]model.AccessKey, error)
+	deleteAccessKey(ctx context.Context, namespace, username, accessKeyId string) error
+
+	assumeRole(ctx context.Context, key *model.AccessKey, roleArn, sessionName string, duration time.Duration) (*model.StsCredentials, error)
+}
+
+var (
+	_ ObjectStoreProvider = (*ecsClient)(nil)
+	_ ObjectStoreProvider = (*rgwClient)(nil)
+)
+
+// newProvider builds the client of the config provider
+func newProvider(ctx context.Context, config *model.PluginConfig) (ObjectStoreProvider, error) {
+	switch config.GetProvider() {
+	case model.ProviderEcs:
+		return newClient(ctx, config)
+	case model.ProviderCephRgw:
+		return newRgwClient(ctx, config)
+	default:
+		return nil, fmt.Errorf("unknown provider %s", config.Provider)
+	}
+}
+
+// validProvider tells whether the name is one of the supported providers
+func validProvider(name string) bool {
+	return name == model.ProviderEcs || name == model.ProviderCephRgw
+}
+
+// ecsOnly returns the ECS client behind the provider, or an error naming the ECS only feature
+func ecsOnly(provider ObjectStoreProvider, feature string) (*ecsClient, error) {
+	client, ok := provider.(*ecsClient)
+	if !ok {
+		return nil, fmt.Errorf("%s are only supported on ECS connections, not %s", feature, provider.providerType())
+	}
+	return client, nil
+}
+
+// getEcsClient returns the ECS client of the connection, failing for other providers
+func (b *backend) getEcsClient(ctx context.Context, storage logical.Storage, connection, feature string) (*ecsClient, error) {
+	provider, err := b.getClient(ctx, storage, connection)
+	if err != nil {
+		return nil, err
+	}
+	return ecsOnly(provider, feature)
+}
+
+// createIamUser creates the role iam user, or reuses and reconciles an existing one, and sets a new access key
+// as the only role key
+func createIamUser(ctx context.Context, provider ObjectStoreProvider, role *model.Role) error {
+	if err := provider.checkRoleSupported(role); err != nil {
+		return err
+	}
+	found, err := provider.checkNsExists(ctx, role.Namespace)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("namespace %s not found", role.Namespace)
+	}
+	found, err = provider.checkIamUserExists(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	var key *model.AccessKey
+	if !found {
+		key, err = provider.createIamUserAndKey(ctx, role.Namespace, role.Username, role)
+		if err != nil {
+			return err
+		}
+	} else {
+		if _, err := provider.reconcileIamUser(ctx, role.Namespace, role.Username, role); err != nil {
+			return err
+		}
+		keys, err := provider.listAccessKeys(ctx, role.Namespace, role.Username)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 1 {
+			return fmt.Errorf("user %v has already 2 access keys", role.Username)
+		}
+		// create first or second key
+		key, err = provider.createAccessKey(ctx, role.Namespace, role.Username)
+		if err != nil {
+			return err
+		}
+	}
+	role.AccessKeys = []*model.AccessKey{key}
+	return nil
+}
+
+// createDynamicUser creates a new uniquely named iam user with a single access key
+func createDynamicUser(ctx context.Context, provider ObjectStoreProvider, role *model.Role, username string) (*model.AccessKey, error) {
+	if err := provider.checkRoleSupported(role); err != nil {
+		return nil, err
+	}
+	key, err := provider.createIamUserAndKey(ctx, role.Namespace, username, role)
+	if err != nil {
+		// don't leave a half created user behind, the WAL rollback retries if this fails
+		if delErr := provider.deleteIamUserAndKeys(ctx, role.Namespace, username); delErr != nil {
+			blog.Warn("cleaning up dynamic user", "username", username, "error", delErr)
+		}
+		return nil, err
+	}
+	key.UserName = username
+	return key, nil
+}
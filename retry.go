@@ -0,0 +1,162 @@
+package os2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cenkalti/backoff/v3"
+	"net/url"
+	"os2/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryInitialInterval is the wait before the first retry, it grows exponentially up to the config max_retry_backoff
+const retryInitialInterval = 250 * time.Millisecond
+
+// idempotentIamActions are the aws style iam actions that can be sent again without changing the outcome,
+// creations are not among them as a retry after a lost response would create a second user or key
+var idempotentIamActions = []string{"Get", "List", "Delete", "Detach", "Put", "Attach", "Tag", "Untag"}
+
+// errCircuitOpen is returned without calling the object store while the circuit breaker is open
+var errCircuitOpen = errors.New("circuit breaker open, the object store is failing")
+
+// retryPolicy retries the transient failures of idempotent calls with exponential backoff and jitter,
+// behind a circuit breaker shared by all the calls of the connection
+type retryPolicy struct {
+	maxRetries int
+	maxBackoff time.Duration
+	breaker    *circuitBreaker
+}
+
+func newRetryPolicy(config *model.PluginConfig) *retryPolicy {
+	return &retryPolicy{
+		maxRetries: config.GetMaxRetries(),
+		maxBackoff: config.GetMaxRetryBackoff(),
+		breaker:    newCircuitBreaker(config.GetBreakerThreshold(), config.GetBreakerCooldown()),
+	}
+}
+
+// run calls op until it succeeds, fails for good, or the retries of an idempotent call are exhausted
+func (p *retryPolicy) run(ctx context.Context, idempotent bool, op func() error) error {
+	attempt := func() error {
+		if err := p.breaker.allow(time.Now()); err != nil {
+			return backoff.Permanent(err)
+		}
+		err := op()
+		if ctx.Err() == nil {
+			// a cancelled call says nothing about the object store health
+			p.breaker.record(isTransient(ctx, err), time.Now())
+		}
+		if err != nil && (!idempotent || !isTransient(ctx, err)) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	if !idempotent || p.maxRetries <= 0 {
+		return unwrapPermanent(attempt())
+	}
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = retryInitialInterval
+	policy.MaxInterval = p.maxBackoff
+	// the number of retries and the request context bound the calls, not the elapsed time
+	policy.MaxElapsedTime = 0
+	notify := func(err error, wait time.Duration) {
+		blog.Warn("object store call failed, retrying", "error", err, "wait", wait)
+	}
+	return backoff.RetryNotify(attempt, backoff.WithContext(backoff.WithMaxRetries(policy, uint64(p.maxRetries)), ctx), notify)
+}
+
+func unwrapPermanent(err error) error {
+	if permanent, ok := err.(*backoff.PermanentError); ok {
+		return permanent.Err
+	}
+	return err
+}
+
+// isTransient tells whether the call may succeed if sent again: connection failures, 429 and 5xx answers
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, errCircuitOpen) {
+		return false
+	}
+	if apiErr, ok := err.(*ApiError); ok {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+	return true
+}
+
+// isIdempotent tells whether the request can be retried, POST calls only when they are read or
+// delete style iam actions
+func isIdempotent(method, path string) bool {
+	if method != POST {
+		return true
+	}
+	_, query, found := strings.Cut(path, "?")
+	if !found {
+		return false
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return false
+	}
+	return isIdempotentAction(values.Get("Action"))
+}
+
+func isIdempotentAction(action string) bool {
+	for _, prefix := range idempotentIamActions {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// circuitBreaker opens after threshold consecutive transient failures and fails calls fast for the cooldown,
+// then lets calls through again, a single failure opening it anew until a call succeeds
+type circuitBreaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// newCircuitBreaker returns nil, a breaker that never opens, when threshold is 0
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (cb *circuitBreaker) allow(now time.Time) error {
+	if cb == nil {
+		return nil
+	}
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if now.Before(cb.openUntil) {
+		return fmt.Errorf("%w, retrying after %s", errCircuitOpen, cb.openUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (cb *circuitBreaker) record(failed bool, now time.Time) {
+	if cb == nil {
+		return
+	}
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if !failed {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.failures >= cb.threshold {
+		if !now.Before(cb.openUntil) {
+			blog.Warn("object store failing, opening the circuit breaker", "failures", cb.failures, "cooldown", cb.cooldown)
+		}
+		cb.openUntil = now.Add(cb.cooldown)
+	}
+}
@@ -0,0 +1,364 @@
+package os2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os2/model"
+	"strings"
+	"time"
+)
+
+const (
+	rgwUserPath     = "/admin/user"
+	rgwMetadataPath = "/admin/metadata/user"
+	// rgwTenantSeparator joins the tenant and the user id in RGW user ids
+	rgwTenantSeparator = "$"
+)
+
+// rgwClient manages the iam users of a Ceph RADOS gateway through its admin ops api, signed with the
+// config username and password as s3 access key and secret. Namespaces are RGW tenants, users get their
+// keys from the admin ops api and their inline policy from the RGW iam api.
+type rgwClient struct {
+	client    *http.Client
+	url       string
+	accessKey string
+	secretKey string
+	retry     *retryPolicy
+}
+
+func newRgwClient(ctx context.Context, config *model.PluginConfig) (*rgwClient, error) {
+	if config.Url == "" {
+		return nil, errors.New("no Ceph RGW url configured")
+	}
+	client := &rgwClient{
+		client:    newHttpClient(config),
+		url:       strings.TrimSuffix(config.Url, "/"),
+		accessKey: config.Username,
+		secretKey: config.Password,
+		retry:     newRetryPolicy(config),
+	}
+	// the admin ops api has no login, check the credentials like ECS does by reading the admin user
+	query := url.Values{"access-key": {client.accessKey}}
+	if err := client.adminAPI(ctx, GET, rgwUserPath, query, nil); err != nil {
+		return nil, fmt.Errorf("Ceph RGW admin login: %w", err)
+	}
+	return client, nil
+}
+
+func (c *rgwClient) providerType() string {
+	return model.ProviderCephRgw
+}
+
+// rgwUid is the RGW user id of the user in the tenant, users outside a tenant keep their name
+func rgwUid(namespace, username string) string {
+	if namespace == "" {
+		return username
+	}
+	return namespace + rgwTenantSeparator + username
+}
+
+// checkRoleSupported rejects the role settings RGW users cannot have
+func (c *rgwClient) checkRoleSupported(role *model.Role) error {
+	if len(role.PolicyArns) > 0 || len(role.Groups) > 0 || len(role.Tags) > 0 {
+		return errors.New("Ceph RGW users only support policy_document, not policy_arns, groups or tags")
+	}
+	return nil
+}
+
+// checkNsExists always succeeds, RGW tenants are created along with their first user
+func (c *rgwClient) checkNsExists(ctx context.Context, namespace string) (bool, error) {
+	return true, nil
+}
+
+func (c *rgwClient) getUser(ctx context.Context, namespace, username string) (*model.RgwUser, error) {
+	var user model.RgwUser
+	query := url.Values{"uid": {rgwUid(namespace, username)}}
+	if err := c.adminAPI(ctx, GET, rgwUserPath, query, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *rgwClient) checkIamUserExists(ctx context.Context, namespace, username string) (bool, error) {
+	if _, err := c.getUser(ctx, namespace, username); err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// getIamUsers lists the users of the tenant
+func (c *rgwClient) getIamUsers(ctx context.Context, namespace string) ([]model.IamUser, error) {
+	var uids []string
+	if err := c.adminAPI(ctx, GET, rgwMetadataPath, nil, &uids); err != nil {
+		return nil, err
+	}
+	users := []model.IamUser{}
+	for _, uid := range uids {
+		tenant, username, found := strings.Cut(uid, rgwTenantSeparator)
+		if !found {
+			tenant, username = "", uid
+		}
+		if tenant == namespace {
+			users = append(users, model.IamUser{UserName: username})
+		}
+	}
+	return users, nil
+}
+
+// createIamUserAndKey creates the user without keys, puts the role inline policy and creates its first key
+func (c *rgwClient) createIamUserAndKey(ctx context.Context, namespace, username string, role *model.Role) (*model.AccessKey, error) {
+	query := url.Values{
+		"uid":          {rgwUid(namespace, username)},
+		"display-name": {username},
+		"generate-key": {"false"},
+	}
+	if err := c.adminAPI(ctx, PUT, rgwUserPath, query, nil); err != nil {
+		return nil, err
+	}
+	if role.PolicyDocument != "" {
+		if err := c.putUserPolicy(ctx, namespace, username, role.PolicyDocument); err != nil {
+			return nil, err
+		}
+	}
+	return c.createAccessKey(ctx, namespace, username)
+}
+
+// describeIamUser fills the role inline policy, RGW users have no managed policies, groups or tags
+func (c *rgwClient) describeIamUser(ctx context.Context, role *model.Role) error {
+	policyDocument, err := c.getUserPolicy(ctx, role.Namespace, role.Username)
+	if err != nil {
+		return err
+	}
+	role.PolicyArns = nil
+	role.PolicyDocument = policyDocument
+	role.Groups = nil
+	role.Tags = nil
+	return nil
+}
+
+// reconcileIamUser puts or deletes the inline policy of the user to match the role
+func (c *rgwClient) reconcileIamUser(ctx context.Context, namespace, username string, role *model.Role) ([]string, error) {
+	if err := c.checkRoleSupported(role); err != nil {
+		return nil, err
+	}
+	inline, err := c.getUserPolicy(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case role.PolicyDocument == "" && inline != "":
+		if err := c.deleteUserPolicy(ctx, namespace, username); err != nil {
+			return nil, err
+		}
+		return []string{"deleted inline policy"}, nil
+	case role.PolicyDocument != "" && !sameJSON(inline, role.PolicyDocument):
+		if err := c.putUserPolicy(ctx, namespace, username, role.PolicyDocument); err != nil {
+			return nil, err
+		}
+		return []string{"put inline policy"}, nil
+	}
+	return nil, nil
+}
+
+// deleteIamUserAndKeys deletes the user, RGW removes its keys and policies along with it
+func (c *rgwClient) deleteIamUserAndKeys(ctx context.Context, namespace, username string) error {
+	query := url.Values{"uid": {rgwUid(namespace, username)}, "purge-data": {"false"}}
+	if err := c.adminAPI(ctx, DELETE, rgwUserPath, query, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *rgwClient) deleteUser(ctx context.Context, userType, namespace, username string) error {
+	if userType == model.UserTypeObjectUser {
+		return errors.New("object users are only supported on ECS connections")
+	}
+	return c.deleteIamUserAndKeys(ctx, namespace, username)
+}
+
+// createAccessKey generates a new s3 key, RGW answers with all the user keys so the new one is the one not there before
+func (c *rgwClient) createAccessKey(ctx context.Context, namespace, username string) (*model.AccessKey, error) {
+	before, err := c.listAccessKeys(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	var keys []model.RgwKey
+	query := url.Values{
+		"key":          {""},
+		"uid":          {rgwUid(namespace, username)},
+		"key-type":     {"s3"},
+		"generate-key": {"true"},
+	}
+	if err := c.adminAPI(ctx, PUT, rgwUserPath, query, &keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if !containsKey(before, key.AccessKey) {
+			// RGW keeps no creation date, the plugin needs one to tell the oldest key
+			return &model.AccessKey{
+				AccessKeyId:     key.AccessKey,
+				UserName:        username,
+				SecretAccessKey: key.SecretKey,
+				CreateDate:      time.Now().UTC().Format(time.RFC3339),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("new access key of user %s not found", username)
+}
+
+// listAccessKeys lists the user keys without creation date, RGW keeps none
+func (c *rgwClient) listAccessKeys(ctx context.Context, namespace, username string) ([]model.AccessKey, error) {
+	user, err := c.getUser(ctx, namespace, username)
+	if err != nil {
+		return nil, err
+	}
+	var keys []model.AccessKey
+	for _, key := range user.Keys {
+		keys = append(keys, model.AccessKey{AccessKeyId: key.AccessKey, UserName: username})
+	}
+	return keys, nil
+}
+
+func (c *rgwClient) deleteAccessKey(ctx context.Context, namespace, username, accessKeyId string) error {
+	query := url.Values{
+		"key":        {""},
+		"uid":        {rgwUid(namespace, username)},
+		"access-key": {accessKeyId},
+	}
+	if err := c.adminAPI(ctx, DELETE, rgwUserPath, query, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *rgwClient) getUserPolicy(ctx context.Context, namespace, username string) (string, error) {
+	var response model.GetUserPolicy
+	form := url.Values{
+		"Action":     {"GetUserPolicy"},
+		"PolicyName": {inlinePolicyName},
+		"UserName":   {rgwUid(namespace, username)},
+	}
+	if err := c.iamAPI(ctx, form, &response); err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return "", nil
+		}
+		return "", err
+	}
+	document, err := url.QueryUnescape(response.GetUserPolicyResult.PolicyDocument)
+	if err != nil {
+		return response.GetUserPolicyResult.PolicyDocument, nil
+	}
+	return document, nil
+}
+
+func (c *rgwClient) putUserPolicy(ctx context.Context, namespace, username, policyDocument string) error {
+	form := url.Values{
+		"Action":         {"PutUserPolicy"},
+		"PolicyName":     {inlinePolicyName},
+		"UserName":       {rgwUid(namespace, username)},
+		"PolicyDocument": {policyDocument},
+	}
+	return c.iamAPI(ctx, form, nil)
+}
+
+func (c *rgwClient) deleteUserPolicy(ctx context.Context, namespace, username string) error {
+	form := url.Values{
+		"Action":     {"DeleteUserPolicy"},
+		"PolicyName": {inlinePolicyName},
+		"UserName":   {rgwUid(namespace, username)},
+	}
+	if err := c.iamAPI(ctx, form, nil); err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// assumeRole requests temporary credentials of the role from the RGW STS api, served at the root of the gateway
+func (c *rgwClient) assumeRole(ctx context.Context, key *model.AccessKey, roleArn, sessionName string, duration time.Duration) (*model.StsCredentials, error) {
+	return stsAssumeRole(ctx, c.client, c.url+"/", key, roleArn, sessionName, duration)
+}
+
+// adminAPI calls the admin ops api and decodes its json response into obj
+func (c *rgwClient) adminAPI(ctx context.Context, method, path string, query url.Values, obj any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("format", "json")
+	// user and key creations are PUT calls, only reads and deletions are safe to send again
+	idempotent := method == GET || method == DELETE
+	var body []byte
+	err := c.retry.run(ctx, idempotent, func() error {
+		req, err := http.NewRequestWithContext(ctx, method, c.url+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		signV4(req, nil, c.accessKey, c.secretKey, "s3", time.Now())
+		body, err = c.do(req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 && obj != nil {
+		return json.Unmarshal(body, obj)
+	}
+	return nil
+}
+
+// iamAPI posts the aws style iam action and decodes its xml response into obj
+func (c *rgwClient) iamAPI(ctx context.Context, form url.Values, obj any) error {
+	body := []byte(form.Encode())
+	var respBody []byte
+	err := c.retry.run(ctx, isIdempotentAction(form.Get("Action")), func() error {
+		req, err := http.NewRequestWithContext(ctx, POST, c.url+"/", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signV4(req, body, c.accessKey, c.secretKey, "iam", time.Now())
+		respBody, err = c.do(req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(respBody) > 0 && obj != nil {
+		return xml.Unmarshal(respBody, obj)
+	}
+	return nil
+}
+
+func (c *rgwClient) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 300 {
+		return nil, newApiError(resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,143 @@
+package os2
+
+import (
+	"context"
+	"errors"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
+)
+
+const (
+	// first retry delay after a failed scheduled rotation, doubled on each consecutive failure
+	rotationRetryBaseDelay = time.Minute
+	rotationRetryMaxDelay  = 6 * time.Hour
+)
+
+// periodicFunc is invoked by vault roughly every minute
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.canWrite() {
+		return nil
+	}
+	return errors.Join(
+		b.rotateRootPasswordsIfDue(ctx, req.Storage),
+		b.rotateDueRoles(ctx, req.Storage),
+	)
+}
+
+// rotateRootPasswordsIfDue rotates the management password of every connection whose rotation period has elapsed,
+// after resolving the pending password of an unfinished rotation
+func (b *backend) rotateRootPasswordsIfDue(ctx context.Context, storage logical.Storage) error {
+	connections, err := listConnections(ctx, storage)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, connection := range connections {
+		errs = append(errs, b.rotateRootPasswordIfDue(ctx, storage, connection))
+	}
+	return errors.Join(errs...)
+}
+
+func (b *backend) rotateRootPasswordIfDue(ctx context.Context, storage logical.Storage, connection string) error {
+	config, err := GetConfig(ctx, storage, connection)
+	if err != nil || config == nil {
+		return err
+	}
+	if config.PendingPassword != "" {
+		// a rotation that changed ECS but could not log in leaves the mount on the old password,
+		// resolve it whatever the schedule
+		if err := b.recoverPendingPassword(ctx, storage, connection); err != nil {
+			b.Logger().Warn("recovering pending password", "connection", connection, "error", err)
+			return err
+		}
+		// a promotion counts as the rotation of the schedule
+		if config, err = GetConfig(ctx, storage, connection); err != nil || config == nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	next := config.NextRotation()
+	if next.IsZero() || now.Before(next) || now.Before(b.rootRotationRetryAt[connection]) {
+		return nil
+	}
+	if err := b.rotateRootPassword(ctx, storage, connection); err != nil {
+		b.rootRotationFailures[connection]++
+		b.rootRotationRetryAt[connection] = now.Add(retryDelay(b.rootRotationFailures[connection]))
+		b.Logger().Warn("scheduled password rotation failed", "connection", connection, "error", err)
+		return err
+	}
+	delete(b.rootRotationFailures, connection)
+	delete(b.rootRotationRetryAt, connection)
+	b.Logger().Info("rotated ECS management password", "connection", connection)
+	return nil
+}
+
+// canWrite is false on nodes where the mount storage is read only
+func (b *backend) canWrite() bool {
+	replState := b.System().ReplicationState()
+	if replState.HasState(consts.ReplicationDRSecondary | consts.ReplicationPerformanceStandby) {
+		return false
+	}
+	return b.System().LocalMount() || !replState.HasState(consts.ReplicationPerformanceSecondary)
+}
+
+// rotateDueRoles rotates the keys of every role whose rotation is due, failed rotations are retried with backoff
+func (b *backend) rotateDueRoles(ctx context.Context, storage logical.Storage) error {
+	roleNames, err := storage.List(ctx, "role/")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, roleName := range roleNames {
+		if strings.HasSuffix(roleName, "/") {
+			continue
+		}
+		role, err := getRole(ctx, storage, roleName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		now := time.Now().UTC()
+		if role == nil || !role.RotationDue(now) {
+			continue
+		}
+		if _, err := b.rotateRoleKey(ctx, storage, roleName); err != nil {
+			b.Logger().Warn("scheduled rotation failed", "role", roleName, "error", err)
+			errs = append(errs, err)
+			if err := b.delayRotation(ctx, storage, roleName, now); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		b.Logger().Info("rotated role access key", "role", roleName)
+	}
+	return errors.Join(errs...)
+}
+
+// delayRotation pushes back the next rotation of a role after a failure
+func (b *backend) delayRotation(ctx context.Context, storage logical.Storage, roleName string, now time.Time) error {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	role, err := getRole(ctx, storage, roleName)
+	if err != nil || role == nil {
+		return err
+	}
+	role.Name = roleName
+	role.RotationFailures++
+	role.NextRotation = now.Add(retryDelay(role.RotationFailures))
+	return setRole(ctx, storage, role)
+}
+
+func retryDelay(failures int) time.Duration {
+	delay := rotationRetryBaseDelay
+	for i := 1; i < failures && delay < rotationRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > rotationRetryMaxDelay {
+		return rotationRetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,169 @@
+package os2
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/exp/slices"
+	"os2/model"
+	"time"
+)
+
+const (
+	// walRoleCreateKind is written before the iam user of a static role is created or adopted
+	walRoleCreateKind = "roleCreate"
+	// walDynamicUserKind is written before the iam user of a dynamic lease is created
+	walDynamicUserKind = "dynamicUser"
+	// walRoleDeleteKind is written before a role is removed from storage, its iam user still has to be deleted
+	walRoleDeleteKind = "roleDelete"
+
+	// leave in-flight operations enough time to complete before rolling them back
+	walRollbackMinAge = 5 * time.Minute
+)
+
+type walIamUser struct {
+	RoleName    string `mapstructure:"role_name" json:"role_name"`
+	Namespace   string `mapstructure:"namespace" json:"namespace"`
+	Connection  string `mapstructure:"connection" json:"connection"`
+	Username    string `mapstructure:"username" json:"username"`
+	UserType    string `mapstructure:"user_type" json:"user_type"`
+	UserExisted bool   `mapstructure:"user_existed" json:"user_existed"`
+	// KeysBefore holds access key ids, or the creation dates of object user secret keys which share the same id
+	KeysBefore []string `mapstructure:"keys_before" json:"keys_before"`
+}
+
+// putRoleCreateWAL records the iam user state before a static role creation touches it
+func (b *backend) putRoleCreateWAL(ctx context.Context, storage logical.Storage, provider ObjectStoreProvider, role *model.Role) (string, error) {
+	namespace, username := role.Namespace, role.Username
+	entry := walIamUser{
+		RoleName:   role.Name,
+		Namespace:  namespace,
+		Connection: role.Connection,
+		Username:   username,
+		UserType:   role.UserType,
+	}
+	if role.IsObjectUser() {
+		client, err := ecsOnly(provider, "object users")
+		if err != nil {
+			return "", err
+		}
+		found, err := client.checkObjectUserExists(ctx, namespace, username)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			keys, err := client.listSecretKeys(ctx, namespace, username)
+			if err != nil {
+				return "", err
+			}
+			entry.UserExisted = true
+			for _, key := range keys {
+				entry.KeysBefore = append(entry.KeysBefore, key.CreateDate)
+			}
+		}
+		return framework.PutWAL(ctx, storage, walRoleCreateKind, &entry)
+	}
+	found, err := provider.checkIamUserExists(ctx, namespace, username)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		keys, err := provider.listAccessKeys(ctx, namespace, username)
+		if err != nil {
+			return "", err
+		}
+		entry.UserExisted = true
+		for _, key := range keys {
+			entry.KeysBefore = append(entry.KeysBefore, key.AccessKeyId)
+		}
+	}
+	return framework.PutWAL(ctx, storage, walRoleCreateKind, &entry)
+}
+
+func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	var entry walIamUser
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+	client, err := b.getClient(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case walRoleCreateKind:
+		return b.rollbackRoleCreate(ctx, req.Storage, client, entry)
+	case walDynamicUserKind:
+		return client.deleteIamUserAndKeys(ctx, entry.Namespace, entry.Username)
+	case walRoleDeleteKind:
+		return b.completeRoleDelete(ctx, req.Storage, client, entry)
+	default:
+		return fmt.Errorf("unknown WAL entry kind %s", kind)
+	}
+}
+
+// rollbackRoleCreate undoes the ECS changes of a role creation that was never stored
+func (b *backend) rollbackRoleCreate(ctx context.Context, storage logical.Storage, client ObjectStoreProvider, entry walIamUser) error {
+	role, err := getRole(ctx, storage, entry.RoleName)
+	if err != nil {
+		return err
+	}
+	if role != nil && role.Namespace == entry.Namespace && role.Username == entry.Username && role.Connection == entry.Connection {
+		// the role made it to storage, nothing to roll back
+		return nil
+	}
+	if !entry.UserExisted {
+		return client.deleteUser(ctx, entry.UserType, entry.Namespace, entry.Username)
+	}
+	// the user was adopted, only remove the keys created since
+	if entry.UserType == model.UserTypeObjectUser {
+		ecs, err := ecsOnly(client, "object users")
+		if err != nil {
+			return err
+		}
+		keys, err := ecs.listSecretKeys(ctx, entry.Namespace, entry.Username)
+		if err != nil {
+			if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+				return nil
+			}
+			return err
+		}
+		for _, key := range keys {
+			if !slices.Contains(entry.KeysBefore, key.CreateDate) {
+				if err := ecs.deleteSecretKey(ctx, entry.Namespace, entry.Username, key.SecretAccessKey); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	keys, err := client.listAccessKeys(ctx, entry.Namespace, entry.Username)
+	if err != nil {
+		if apiErr, ok := err.(*ApiError); ok && apiErr.Code == 404 {
+			return nil
+		}
+		return err
+	}
+	for _, key := range keys {
+		if !slices.Contains(entry.KeysBefore, key.AccessKeyId) {
+			if err := client.deleteAccessKey(ctx, entry.Namespace, entry.Username, key.AccessKeyId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// completeRoleDelete deletes the iam user of a role removed from storage
+func (b *backend) completeRoleDelete(ctx context.Context, storage logical.Storage, client ObjectStoreProvider, entry walIamUser) error {
+	role, err := getRole(ctx, storage, entry.RoleName)
+	if err != nil {
+		return err
+	}
+	if role != nil && role.Namespace == entry.Namespace && role.Username == entry.Username && role.Connection == entry.Connection {
+		// the role has been created again since, its user must stay
+		return nil
+	}
+	return client.deleteUser(ctx, entry.UserType, entry.Namespace, entry.Username)
+}